@@ -134,8 +134,28 @@ create table replication_policy (
  enabled tinyint(1) NOT NULL DEFAULT 1,
  description text,
  deleted tinyint (1) DEFAULT 0 NOT NULL,
+ /*
+ direction indicates the direction of replication,
+ push means replicating from local to the target,
+ pull means replicating from the target to local
+ */
+ direction varchar(8) NOT NULL DEFAULT 'push',
+ /*
+ filters is the json encoded rules to select the repositories and tags to replicate
+ */
+ filters text,
+ /*
+ time_windows is the json encoded daily time windows during which the jobs may start,
+ the jobs may start at any time if it is empty
+ */
+ time_windows text,
  cron_str varchar(256),
  start_time timestamp NULL,
+ /*
+ next_run_time is the next time the scheduler of job service triggers the replication,
+ it is null if the policy is not scheduled
+ */
+ next_run_time timestamp NULL,
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
  PRIMARY KEY (id)
@@ -153,6 +173,30 @@ create table replication_target (
  1 means it's a regulart registry
  */
  target_type tinyint(1) NOT NULL DEFAULT 0,
+ /*
+ bandwidth_limit is the max rate in KB per second of the blobs transferred
+ with the target by all the jobs, 0 means no limit
+ */
+ bandwidth_limit int NOT NULL DEFAULT 0,
+ /*
+ insecure indicates whether to skip the verification of the certificate of the target,
+ ca_cert is the PEM encoded CA bundle to verify the certificate of the target,
+ client_cert and client_key are the PEM encoded certificate and key presented to the
+ target, client_key is encrypted
+ */
+ insecure tinyint(1) NOT NULL DEFAULT 0,
+ ca_cert text,
+ client_cert text,
+ client_key text,
+ /*
+ proxy_url is the URL of the HTTP(S) proxy through which the target is connected,
+ proxy_password is encrypted, no_proxy is a comma separated list of hosts, domains
+ and CIDRs which are connected directly
+ */
+ proxy_url varchar(256),
+ proxy_username varchar(40),
+ proxy_password varchar(128),
+ no_proxy varchar(512),
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
  PRIMARY KEY (id)
@@ -161,17 +205,103 @@ create table replication_target (
 create table replication_job (
  id int NOT NULL AUTO_INCREMENT,
  status varchar(64) NOT NULL,
+ /*
+ the kind of the job which selects the job type handling it, all kinds of jobs
+ share the job queue
+ */
+ kind varchar(64) NOT NULL DEFAULT 'replication',
  policy_id int NOT NULL,
  repository varchar(256) NOT NULL,
  operation  varchar(64) NOT NULL,
  tags   varchar(16384),
+ /*
+ the digest of the manifest replicated, it is set when the job is created if
+ the tag is pinned to the digest of the push event which triggers the job
+ */
+ digest varchar(128),
+ execution_id int NOT NULL DEFAULT 0,
+ retry_count int NOT NULL DEFAULT 0,
+ next_attempt_time timestamp NULL,
+ progress text,
+ lease_owner varchar(64),
+ lease_expire_time timestamp NULL,
  creation_time timestamp default CURRENT_TIMESTAMP,
  update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
  PRIMARY KEY (id),
  INDEX policy (policy_id),
- INDEX poid_uptime (policy_id, update_time)
+ INDEX poid_uptime (policy_id, update_time),
+ INDEX status (status),
+ INDEX execution (execution_id)
+ );
+
+/*
+ replication_execution is a run of a policy triggered once, which owns the jobs created by the run
+*/
+create table replication_execution (
+ id int NOT NULL AUTO_INCREMENT,
+ policy_id int NOT NULL,
+ /*
+ trigger_source is what triggered the execution: manual, push or schedule
+ */
+ trigger_source varchar(64) NOT NULL,
+ start_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ INDEX policy (policy_id)
+ );
+
+create table replication_job_attempt (
+ id int NOT NULL AUTO_INCREMENT,
+ job_id int NOT NULL,
+ attempt int NOT NULL,
+ error text,
+ creation_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ INDEX job (job_id)
+ );
+
+/*
+ replication_blob_location records a repository of the target in which the blob exists,
+ it is used to mount the blob when it is replicated to other repositories of the target
+*/
+create table replication_blob_location (
+ id int NOT NULL AUTO_INCREMENT,
+ target_id int NOT NULL,
+ digest varchar(128) NOT NULL,
+ repository varchar(256) NOT NULL,
+ update_time timestamp default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ UNIQUE (target_id, digest)
  );
  
+/*
+ replication_target_status records the results of the health checks of targets
+*/
+create table replication_target_status (
+ id int NOT NULL AUTO_INCREMENT,
+ target_id int NOT NULL,
+ reachable tinyint(1) NOT NULL DEFAULT 0,
+ auth_valid tinyint(1) NOT NULL DEFAULT 0,
+ /*
+ latency is the time in milliseconds the target takes to respond to the ping
+ */
+ latency int NOT NULL DEFAULT 0,
+ error text,
+ check_time timestamp default CURRENT_TIMESTAMP,
+ PRIMARY KEY (id),
+ INDEX target (target_id)
+ );
+
+/*
+ lease records the job service instance which runs the task that must run on a single
+ instance, such as the health check of targets, until the lease expires
+*/
+create table lease (
+ name varchar(64) NOT NULL,
+ owner varchar(64) NOT NULL,
+ expire_time timestamp NULL,
+ primary key (name)
+ );
+
 create table properties (
  k varchar(64) NOT NULL,
  v varchar(128) NOT NULL,
@@ -182,4 +312,4 @@ CREATE TABLE IF NOT EXISTS `alembic_version` (
     `version_num` varchar(32) NOT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
-insert into alembic_version values ('0.4.0');
+insert into alembic_version values ('0.5.0');
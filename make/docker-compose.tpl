@@ -64,6 +64,7 @@ services:
     env_file:
       - ./common/config/jobservice/env
     restart: always
+    stop_grace_period: 90s
     volumes:
       - /data/job_logs:/var/log/jobs
       - ./common/config/jobservice/app.conf:/etc/jobservice/app.conf
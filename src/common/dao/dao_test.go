@@ -16,7 +16,9 @@
 package dao
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -1082,6 +1084,11 @@ func TestUpdateRepTarget(t *testing.T) {
 	target.URL = "http://new_url"
 	target.Username = "new_username"
 	target.Password = "new_password"
+	target.BandwidthLimit = 1024
+	target.Insecure = true
+	target.CACert = "ca_cert"
+	target.ProxyURL = "http://proxy:3128"
+	target.NoProxy = "localhost"
 
 	if err = UpdateRepTarget(*target); err != nil {
 		t.Fatalf("failed to update target: %v", err)
@@ -1107,6 +1114,18 @@ func TestUpdateRepTarget(t *testing.T) {
 	if target.Password != "new_password" {
 		t.Errorf("unexpected password: %s, expected: %s", target.Password, "new_password")
 	}
+
+	if target.BandwidthLimit != 1024 {
+		t.Errorf("unexpected bandwidth limit: %d, expected: %d", target.BandwidthLimit, 1024)
+	}
+
+	if !target.Insecure || target.CACert != "ca_cert" {
+		t.Errorf("unexpected TLS settings: insecure %v, CA cert %s", target.Insecure, target.CACert)
+	}
+
+	if target.ProxyURL != "http://proxy:3128" || target.NoProxy != "localhost" {
+		t.Errorf("unexpected proxy settings: proxy URL %s, no proxy %s", target.ProxyURL, target.NoProxy)
+	}
 }
 
 func TestFilterRepTargets(t *testing.T) {
@@ -1151,6 +1170,9 @@ func TestAddRepPolicy(t *testing.T) {
 	if !p.StartTime.After(tm) {
 		t.Errorf("Unexpected start_time: %v", p.StartTime)
 	}
+	if p.Direction != models.RepDirectionPush {
+		t.Errorf("unexpected direction: %s != %s", p.Direction, models.RepDirectionPush)
+	}
 
 }
 
@@ -1242,6 +1264,13 @@ func TestAddRepPolicy2(t *testing.T) {
 		TargetID:    3,
 		Description: "whatever",
 		Name:        "mypolicy",
+		Direction:   models.RepDirectionPull,
+		Filters: []*models.RepFilter{
+			&models.RepFilter{Kind: models.RepFilterKindTag, Type: models.RepFilterTypeGlob, Pattern: "release-*"},
+		},
+		Windows: []*models.RepTimeWindow{
+			&models.RepTimeWindow{Start: "22:00", End: "06:00"},
+		},
 	}
 	policyID2, err := AddRepPolicy(policy2)
 	t.Logf("added policy, id: %d", policyID2)
@@ -1259,6 +1288,46 @@ func TestAddRepPolicy2(t *testing.T) {
 	if p.StartTime.After(tm) {
 		t.Errorf("Unexpected start_time: %v", p.StartTime)
 	}
+	if p.Direction != models.RepDirectionPull {
+		t.Errorf("unexpected direction: %s != %s", p.Direction, models.RepDirectionPull)
+	}
+	if len(p.Filters) != 1 || p.Filters[0].Pattern != "release-*" {
+		t.Errorf("unexpected filters: %+v", p.Filters)
+	}
+	if len(p.Windows) != 1 || p.Windows[0].Start != "22:00" || p.Windows[0].End != "06:00" {
+		t.Errorf("unexpected time windows: %+v", p.Windows)
+	}
+
+	ids, err := GetRepPolicyIDs()
+	if err != nil {
+		t.Fatalf("Error occurred in GetRepPolicyIDs: %v", err)
+	}
+	found := false
+	for _, id := range ids {
+		if id == policyID2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("policy %d should be returned by GetRepPolicyIDs", policyID2)
+	}
+
+	policies, err := GetWindowedRepPolicies()
+	if err != nil {
+		t.Fatalf("Error occurred in GetWindowedRepPolicies: %v", err)
+	}
+	found = false
+	for _, policy := range policies {
+		if policy.ID == policyID2 {
+			found = true
+		}
+		if len(policy.Windows) == 0 {
+			t.Errorf("policy %d has no time window", policy.ID)
+		}
+	}
+	if !found {
+		t.Errorf("policy %d should be returned by GetWindowedRepPolicies", policyID2)
+	}
 }
 
 func TestAddRepJob(t *testing.T) {
@@ -1289,6 +1358,9 @@ func TestAddRepJob(t *testing.T) {
 			"but in returned data:, Status: %s, Repository: %s, Operation: %s, PolicyID: %d, TagList: %v", id, models.JobPending, policyID, j.Status, j.Repository, j.Operation, j.PolicyID, j.TagList)
 		return
 	}
+	if j.Kind != models.JobKindReplication {
+		t.Errorf("Unexpected kind of job: %d, %s != %s", id, j.Kind, models.JobKindReplication)
+	}
 }
 
 func TestUpdateRepJobStatus(t *testing.T) {
@@ -1366,7 +1438,7 @@ func TestGetRepJobByPolicy(t *testing.T) {
 }
 
 func TestFilterRepJobs(t *testing.T) {
-	jobs, _, err := FilterRepJobs(policyID, "", "", nil, nil, 1000, 0)
+	jobs, _, err := FilterRepJobs(policyID, 0, "", "", nil, nil, 1000, 0)
 	if err != nil {
 		t.Errorf("Error occured in FilterRepJobs: %v, policy ID: %d", err, policyID)
 		return
@@ -1450,6 +1522,39 @@ func TestGetRepoJobToStop(t *testing.T) {
 	}
 }
 
+func TestRepBlobLocation(t *testing.T) {
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	if err := SetRepBlobLocation(targetID, digest, "library/busybox"); err != nil {
+		t.Fatalf("failed to set location of blob: %v", err)
+	}
+	if err := SetRepBlobLocation(targetID, digest, "library/alpine"); err != nil {
+		t.Fatalf("failed to set location of blob: %v", err)
+	}
+	location, err := GetRepBlobLocation(targetID, digest)
+	if err != nil {
+		t.Fatalf("failed to get location of blob: %v", err)
+	}
+	if location == nil || location.Repository != "library/alpine" {
+		t.Fatalf("unexpected location of blob: %+v, expected repository: library/alpine", location)
+	}
+
+	if err = DeleteRepBlobLocation(targetID, digest); err != nil {
+		t.Fatalf("failed to delete location of blob: %v", err)
+	}
+	location, err = GetRepBlobLocation(targetID, digest)
+	if err != nil {
+		t.Fatalf("failed to get location of blob: %v", err)
+	}
+	if location != nil {
+		t.Errorf("location of blob should be deleted: %+v", location)
+	}
+
+	// left for TestDeleteRepTarget
+	if err := SetRepBlobLocation(targetID, digest, "library/busybox"); err != nil {
+		t.Fatalf("failed to set location of blob: %v", err)
+	}
+}
+
 func TestDeleteRepTarget(t *testing.T) {
 	err := DeleteRepTarget(targetID)
 	if err != nil {
@@ -1464,6 +1569,14 @@ func TestDeleteRepTarget(t *testing.T) {
 	if tgt != nil {
 		t.Errorf("Able to find target after deletion, id: %d", targetID)
 	}
+	location, err := GetRepBlobLocation(targetID,
+		"sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b")
+	if err != nil {
+		t.Errorf("Error occurred in GetRepBlobLocation: %v", err)
+	}
+	if location != nil {
+		t.Errorf("Able to find blob location of target after deletion, id: %d", targetID)
+	}
 }
 
 func TestFilterRepPolicies(t *testing.T) {
@@ -1499,74 +1612,786 @@ func TestDeleteRepPolicy(t *testing.T) {
 	}
 }
 
-func TestResetRepJobs(t *testing.T) {
+func TestGetJobByStatus(t *testing.T) {
+	r1, err := GetRepJobByStatus(models.JobPending, models.JobRunning)
+	if err != nil {
+		t.Errorf("Failed to run GetRepJobByStatus, error: %v", err)
+	}
+	if len(r1) != 1 {
+		t.Errorf("Unexpected length of result, expected 1, but in fact:%d", len(r1))
+		return
+	}
 
-	job1 := models.RepJob{
-		Repository: "library/ubuntua",
+	r2, err := GetRepJobByStatus(models.JobPending, models.JobCanceled)
+	if err != nil {
+		t.Errorf("Failed to run GetRepJobByStatus, error: %v", err)
+	}
+	if len(r2) != 2 {
+		t.Errorf("Unexpected length of result, expected 2, but in fact:%d", len(r2))
+		return
+	}
+	for _, j := range r2 {
+		DeleteRepJob(j.ID)
+	}
+}
+
+func TestClaimRepJob(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntuc",
 		PolicyID:   policyID,
 		Operation:  "transfer",
-		Status:     models.JobRunning,
 	}
-	job2 := models.RepJob{
-		Repository: "library/ubuntub",
+	id, err := AddRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+
+	now := time.Now()
+	claimed, err := ClaimRepJob("owner", now.Add(time.Minute), now, policyID)
+	if err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != 0 {
+		t.Fatalf("The job of excluded policy should not be claimed, but in fact: %d", claimed)
+	}
+
+	claimed, err = ClaimRepJob("owner", now.Add(time.Minute), now)
+	if err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != id {
+		t.Fatalf("Unexpected claimed job, expected: %d, in fact: %d", id, claimed)
+	}
+	j, err := GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Status != models.JobRunning {
+		t.Errorf("The rep job: %d, status should be Running, but infact: %s", id, j.Status)
+	}
+
+	claimed, err = ClaimRepJob("owner", now.Add(time.Minute), now)
+	if err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != 0 {
+		t.Errorf("No job should be claimed, but in fact: %d", claimed)
+	}
+
+	if err = RenewRepJobLease(id, "owner", now.Add(time.Minute)); err != nil {
+		t.Errorf("Failed to renew the lease of job: %d, error: %v", id, err)
+	}
+	if err = RenewRepJobLease(id, "other", now.Add(time.Minute)); err == nil {
+		t.Errorf("The lease of job: %d should not be renewed by other owner", id)
+	}
+
+	n, err := ReleaseExpiredRepJobs(now)
+	if err != nil {
+		t.Fatalf("Failed to release expired jobs, error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Unexpected count of released jobs, expected: 0, in fact: %d", n)
+	}
+
+	if err = ReleaseRepJob(id, "other"); err == nil {
+		t.Errorf("The job: %d should not be released by other owner", id)
+	}
+
+	n, err = ReleaseRepJobsByOwner("owner")
+	if err != nil {
+		t.Fatalf("Failed to release jobs of owner, error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Unexpected count of released jobs, expected: 1, in fact: %d", n)
+	}
+	j, err = GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Status != models.JobPending {
+		t.Errorf("The rep job: %d, status should be Pending, but infact: %s", id, j.Status)
+	}
+}
+
+func TestUpdateRepJobRetry(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntud",
 		PolicyID:   policyID,
 		Operation:  "transfer",
-		Status:     models.JobCanceled,
 	}
-	id1, err := AddRepJob(job1)
+	id, err := AddRepJob(job)
 	if err != nil {
-		t.Errorf("Failed to add job: %+v, error: %v", job1, err)
-		return
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+
+	now := time.Now()
+	if _, err = ClaimRepJob("owner", now.Add(time.Minute), now); err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
 	}
-	id2, err := AddRepJob(job2)
+	if _, err = AddRepJobAttempt(models.RepJobAttempt{
+		JobID:   id,
+		Attempt: 1,
+		Error:   "connection refused",
+	}); err != nil {
+		t.Fatalf("Failed to add attempt of job: %d, error: %v", id, err)
+	}
+	if err = UpdateRepJobRetry(id, 1, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to update retry of job: %d, error: %v", id, err)
+	}
+
+	j, err := GetRepJob(id)
 	if err != nil {
-		t.Errorf("Failed to add job: %+v, error: %v", job2, err)
-		return
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Status != models.JobRetrying {
+		t.Errorf("The rep job: %d, status should be Retrying, but infact: %s", id, j.Status)
 	}
-	err = ResetRunningJobs()
+	if j.RetryCount != 1 {
+		t.Errorf("Unexpected retry count, expected: 1, in fact: %d", j.RetryCount)
+	}
+
+	claimed, err := ClaimRepJob("owner", now.Add(time.Minute), now)
 	if err != nil {
-		t.Errorf("Failed to reset running jobs, error: %v", err)
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed == id {
+		t.Errorf("The rep job: %d should not be claimed before its next attempt", id)
 	}
-	j1, err := GetRepJob(id1)
+
+	later := now.Add(2 * time.Hour)
+	claimed, err = ClaimRepJob("owner", later.Add(time.Minute), later)
 	if err != nil {
-		t.Errorf("Failed to get rep job, id: %d, error: %v", id1, err)
-		return
+		t.Fatalf("Failed to claim job, error: %v", err)
 	}
-	if j1.Status != models.JobPending {
-		t.Errorf("The rep job: %d, status should be Pending, but infact: %s", id1, j1.Status)
-		return
+	if claimed != id {
+		t.Errorf("Unexpected claimed job, expected: %d, in fact: %d", id, claimed)
 	}
-	j2, err := GetRepJob(id2)
+
+	attempts, err := GetRepJobAttempts(id)
 	if err != nil {
-		t.Errorf("Failed to get rep job, id: %d, error: %v", id2, err)
-		return
+		t.Fatalf("Failed to get attempts of job: %d, error: %v", id, err)
 	}
-	if j2.Status == models.JobPending {
-		t.Errorf("The rep job: %d, status should be Canceled, but infact: %s", id2, j2.Status)
-		return
+	if len(attempts) != 1 || attempts[0].Error != "connection refused" {
+		t.Errorf("Unexpected attempts of job: %d, %+v", id, attempts)
 	}
 }
 
-func TestGetJobByStatus(t *testing.T) {
-	r1, err := GetRepJobByStatus(models.JobPending, models.JobRunning)
+func TestUpdateRepJobProgress(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntue",
+		PolicyID:   policyID,
+		Operation:  "transfer",
+	}
+	id, err := AddRepJob(job)
 	if err != nil {
-		t.Errorf("Failed to run GetRepJobByStatus, error: %v", err)
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
 	}
-	if len(r1) != 1 {
-		t.Errorf("Unexpected length of result, expected 1, but in fact:%d", len(r1))
-		return
+	defer DeleteRepJob(id)
+
+	progress := &models.RepJobProgress{
+		TagsTotal:        2,
+		TagsDone:         1,
+		BytesTransferred: 1024,
+		CurrentBlob:      "sha256:1",
+	}
+	if err = UpdateRepJobProgress(id, progress); err != nil {
+		t.Fatalf("Failed to update progress of job: %d, error: %v", id, err)
 	}
 
-	r2, err := GetRepJobByStatus(models.JobPending, models.JobCanceled)
+	j, err := GetRepJob(id)
 	if err != nil {
-		t.Errorf("Failed to run GetRepJobByStatus, error: %v", err)
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
 	}
-	if len(r2) != 2 {
-		t.Errorf("Unexpected length of result, expected 2, but in fact:%d", len(r2))
-		return
+	if j.Progress == nil {
+		t.Fatalf("The progress of job: %d should not be nil", id)
 	}
-	for _, j := range r2 {
-		DeleteRepJob(j.ID)
+	if j.Progress.TagsTotal != 2 || j.Progress.BytesTransferred != 1024 ||
+		j.Progress.CurrentBlob != "sha256:1" {
+		t.Errorf("Unexpected progress of job: %d, %+v", id, j.Progress)
+	}
+
+	// the locations of uploads carry long state tokens, the uploads of the blobs
+	// transferred concurrently must be stored in full to be resumed
+	state := strings.Repeat("a", 400)
+	progress.Uploads = map[string]*models.RepBlobUpload{}
+	for i := 0; i < 4; i++ {
+		digest := fmt.Sprintf("sha256:%064d", i)
+		progress.Uploads[digest] = &models.RepBlobUpload{
+			Location: fmt.Sprintf("https://registry.example.com/v2/library/ubuntu/blobs/uploads/%d?_state=%s", i, state),
+			Offset:   int64(i) * 1024,
+		}
+	}
+	if err = UpdateRepJobProgress(id, progress); err != nil {
+		t.Fatalf("Failed to update progress of job: %d, error: %v", id, err)
+	}
+	if j, err = GetRepJob(id); err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Progress == nil || len(j.Progress.Uploads) != len(progress.Uploads) {
+		t.Fatalf("Unexpected progress of job: %d, %+v", id, j.Progress)
+	}
+	for digest, upload := range progress.Uploads {
+		if u := j.Progress.Uploads[digest]; u == nil || *u != *upload {
+			t.Errorf("Unexpected upload of blob %s: %+v != %+v", digest, u, upload)
+		}
+	}
+}
+
+func TestUpdateRepJobDigest(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntug",
+		PolicyID:   policyID,
+		Operation:  "transfer",
+		TagList:    []string{"latest"},
+		Digest:     "sha256:1",
+	}
+	id, err := AddRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+
+	j, err := GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Digest != "sha256:1" {
+		t.Errorf("Unexpected digest of job: %d, %s != sha256:1", id, j.Digest)
+	}
+
+	if err = UpdateRepJobDigest(id, "sha256:2"); err != nil {
+		t.Fatalf("Failed to update digest of job: %d, error: %v", id, err)
+	}
+	if j, err = GetRepJob(id); err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Digest != "sha256:2" {
+		t.Errorf("Unexpected digest of job: %d, %s != sha256:2", id, j.Digest)
+	}
+}
+
+func TestUpdateRepJobRetryCount(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntug",
+		PolicyID:   policyID,
+		Operation:  "transfer",
+	}
+	id, err := AddRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+
+	if err = UpdateRepJobRetryCount(id, 6); err != nil {
+		t.Fatalf("Failed to update retry count of job: %d, error: %v", id, err)
+	}
+	j, err := GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.RetryCount != 6 {
+		t.Errorf("Unexpected retry count of job: %d, %d != 6", id, j.RetryCount)
+	}
+}
+
+func TestAddOrMergeRepJob(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntuh",
+		PolicyID:   policyID,
+		Operation:  "transfer",
+		TagList:    []string{"latest"},
+		Digest:     "sha256:1",
+	}
+	id, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+	if merged {
+		t.Errorf("The job: %d should not be merged", id)
+	}
+
+	// the same tag pushed again at the same digest
+	mid, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	if !merged || mid != id {
+		t.Fatalf("The job should be merged into job: %d, but in fact: %d, merged: %v", id, mid, merged)
+	}
+	j, err := GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if len(j.TagList) != 1 || j.Digest != "sha256:1" {
+		t.Errorf("Unexpected tags and digest of job: %d, %v, %s", id, j.TagList, j.Digest)
+	}
+
+	// the same tag pushed again at another digest
+	job.Digest = "sha256:2"
+	pid, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(pid)
+	if merged {
+		t.Errorf("The job: %d pinned to another digest should not be merged", pid)
+	}
+
+	// the jobs which are not pinned
+	job.Digest = ""
+	uid, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(uid)
+	if merged {
+		t.Errorf("The job: %d which is not pinned should not be merged into a pinned job", uid)
+	}
+	job.TagList = []string{"14.04"}
+	if mid, merged, err = AddOrMergeRepJob(job); err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	if !merged || mid != uid {
+		t.Fatalf("The job should be merged into job: %d, but in fact: %d, merged: %v", uid, mid, merged)
+	}
+	if j, err = GetRepJob(uid); err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", uid, err)
+	}
+	if len(j.TagList) != 2 || j.TagList[0] != "latest" || j.TagList[1] != "14.04" || len(j.Digest) != 0 {
+		t.Errorf("Unexpected tags and digest of job: %d, %v, %s", uid, j.TagList, j.Digest)
+	}
+
+	// a delete job is not merged into the transfer job, and the transfer job
+	// after it is not merged into the earlier one
+	job.Operation = "delete"
+	did, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(did)
+	if merged {
+		t.Errorf("The delete job should not be merged into job: %d", did)
+	}
+	job.Operation = "transfer"
+	tid, merged, err := AddOrMergeRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(tid)
+	if merged {
+		t.Errorf("The transfer job should not be merged into job: %d", tid)
+	}
+}
+
+func TestClaimRepJobInOrder(t *testing.T) {
+	ids := []int64{}
+	for _, op := range []string{"transfer", "delete"} {
+		job := models.RepJob{
+			Repository: "library/ubuntui",
+			PolicyID:   policyID,
+			Operation:  op,
+		}
+		id, err := AddRepJob(job)
+		if err != nil {
+			t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+		}
+		defer DeleteRepJob(id)
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	claimed, err := ClaimRepJob("owner", now.Add(time.Minute), now)
+	if err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != ids[0] {
+		t.Fatalf("Unexpected claimed job, expected: %d, in fact: %d", ids[0], claimed)
+	}
+
+	// the delete job waits until the transfer job completes
+	if claimed, err = ClaimRepJob("owner", now.Add(time.Minute), now); err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != 0 {
+		t.Errorf("No job should be claimed, but in fact: %d", claimed)
+	}
+
+	if err = UpdateRepJobStatus(ids[0], models.JobFinished); err != nil {
+		t.Fatalf("Failed to update status of job: %d, error: %v", ids[0], err)
+	}
+	if claimed, err = ClaimRepJob("owner", now.Add(time.Minute), now); err != nil {
+		t.Fatalf("Failed to claim job, error: %v", err)
+	}
+	if claimed != ids[1] {
+		t.Errorf("Unexpected claimed job, expected: %d, in fact: %d", ids[1], claimed)
+	}
+	if err = UpdateRepJobStatus(ids[1], models.JobFinished); err != nil {
+		t.Fatalf("Failed to update status of job: %d, error: %v", ids[1], err)
+	}
+
+	// the jobs of other kinds have no policy and repository, they are not ordered
+	ids = []int64{}
+	for i := 0; i < 2; i++ {
+		job := models.RepJob{
+			Kind:      "test",
+			Operation: "test",
+		}
+		id, err := AddRepJob(job)
+		if err != nil {
+			t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+		}
+		defer DeleteRepJob(id)
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		if claimed, err = ClaimRepJob("owner", now.Add(time.Minute), now); err != nil {
+			t.Fatalf("Failed to claim job, error: %v", err)
+		}
+		if claimed != id {
+			t.Errorf("Unexpected claimed job, expected: %d, in fact: %d", id, claimed)
+		}
+	}
+}
+
+func TestRepExecution(t *testing.T) {
+	eid, err := AddRepExecution(models.RepExecution{
+		PolicyID: policyID,
+		Trigger:  models.RepTriggerManual,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add execution, error: %v", err)
+	}
+	defer DeleteRepExecution(eid)
+
+	ids := []int64{}
+	for _, repo := range []string{"library/ubuntuj", "library/ubuntuk"} {
+		job := models.RepJob{
+			Repository:  repo,
+			PolicyID:    policyID,
+			Operation:   "transfer",
+			ExecutionID: eid,
+		}
+		id, err := AddRepJob(job)
+		if err != nil {
+			t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+		}
+		defer DeleteRepJob(id)
+		ids = append(ids, id)
+	}
+	if err = UpdateRepJobStatus(ids[0], models.JobError); err != nil {
+		t.Fatalf("Failed to update status of job: %d, error: %v", ids[0], err)
+	}
+
+	e, err := GetRepExecution(eid)
+	if err != nil {
+		t.Fatalf("Failed to get execution: %d, error: %v", eid, err)
+	}
+	if e.Total != 2 || e.Failed != 1 || e.InProgress != 1 ||
+		e.Status != models.RepExecutionInProgress || e.EndTime != nil {
+		t.Errorf("Unexpected execution: %+v", e)
+	}
+
+	if err = UpdateRepJobStatus(ids[1], models.JobFinished); err != nil {
+		t.Fatalf("Failed to update status of job: %d, error: %v", ids[1], err)
+	}
+	executions, total, err := FilterRepExecutions(policyID, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to filter executions of policy: %d, error: %v", policyID, err)
+	}
+	if total != 1 || len(executions) != 1 || executions[0].ID != eid {
+		t.Fatalf("Unexpected executions: %d, %+v", total, executions)
+	}
+	if e = executions[0]; e.Succeeded != 1 || e.Failed != 1 ||
+		e.Status != models.RepExecutionFailed || e.EndTime == nil {
+		t.Errorf("Unexpected execution: %+v", e)
+	}
+
+	jobs, err := GetRepJobsByExecution(eid, models.JobError)
+	if err != nil {
+		t.Fatalf("Failed to get jobs of execution: %d, error: %v", eid, err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != ids[0] {
+		t.Errorf("Unexpected failed jobs of execution: %d, %+v", eid, jobs)
+	}
+
+	// the execution is deleted with its last job
+	if _, err = DeleteRepJobs(ids...); err != nil {
+		t.Fatalf("Failed to delete jobs: %v, error: %v", ids, err)
+	}
+	if e, err = GetRepExecution(eid); err != nil {
+		t.Fatalf("Failed to get execution: %d, error: %v", eid, err)
+	}
+	if e != nil {
+		t.Errorf("The execution: %d should be deleted with its jobs", eid)
+	}
+}
+
+func TestRepTargetStatus(t *testing.T) {
+	id, err := AddRepTarget(models.RepTarget{
+		Name: "target_status",
+		URL:  "http://target_status",
+	})
+	if err != nil {
+		t.Fatalf("failed to add target: %v", err)
+	}
+	defer DeleteRepTarget(id)
+
+	for _, reachable := range []bool{true, false} {
+		if _, err = AddRepTargetStatus(models.RepTargetStatus{
+			TargetID:  id,
+			Reachable: reachable,
+			AuthValid: reachable,
+		}); err != nil {
+			t.Fatalf("failed to add status of target %d: %v", id, err)
+		}
+	}
+
+	latest, err := GetLatestRepTargetStatuses(id)
+	if err != nil {
+		t.Fatalf("failed to get latest status of target %d: %v", id, err)
+	}
+	if len(latest) != 1 || latest[0].Reachable {
+		t.Errorf("unexpected latest status: %+v", latest)
+	}
+
+	pid, err := AddRepPolicy(models.RepPolicy{
+		ProjectID: 1,
+		TargetID:  id,
+		Name:      "policy_target_status",
+	})
+	if err != nil {
+		t.Fatalf("failed to add policy: %v", err)
+	}
+	defer DeleteRepPolicy(pid)
+
+	for _, c := range []struct {
+		since    time.Time
+		expected bool
+	}{
+		{time.Now().Add(-time.Hour), true},
+		{time.Now().Add(time.Hour), false},
+	} {
+		ids, err := GetUnreachableRepPolicyIDs(c.since)
+		if err != nil {
+			t.Fatalf("failed to get the policies whose targets are unreachable: %v", err)
+		}
+		found := false
+		for _, i := range ids {
+			if i == pid {
+				found = true
+			}
+		}
+		if found != c.expected {
+			t.Errorf("unexpected policies since %v: %v", c.since, ids)
+		}
+	}
+
+	statuses, total, err := FilterRepTargetStatuses(id, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to filter statuses of target %d: %v", id, err)
+	}
+	if total != 2 || len(statuses) != 2 || statuses[0].Reachable {
+		t.Errorf("unexpected statuses: %d %+v", total, statuses)
+	}
+
+	if _, err = DeleteRepTargetStatuses(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to delete statuses: %v", err)
+	}
+	statuses, total, err = FilterRepTargetStatuses(id, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to filter statuses of target %d: %v", id, err)
+	}
+	if total != 1 || statuses[0].Reachable {
+		t.Errorf("the latest status should be kept: %d %+v", total, statuses)
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	name := "test_lease"
+	now := time.Now()
+	defer GetOrmer().Raw(`delete from lease where name = ?`, name).Exec()
+
+	cases := []struct {
+		owner    string
+		now      time.Time
+		expected bool
+	}{
+		{"owner1", now, true},
+		{"owner2", now, false},
+		{"owner1", now, true},
+		{"owner2", now.Add(2 * time.Minute), true},
+	}
+	for _, c := range cases {
+		acquired, err := AcquireLease(name, c.owner, c.now.Add(time.Minute), c.now)
+		if err != nil {
+			t.Fatalf("failed to acquire lease %s for %s: %v", name, c.owner, err)
+		}
+		if acquired != c.expected {
+			t.Errorf("unexpected result of acquiring lease %s for %s at %v: %t != %t",
+				name, c.owner, c.now, acquired, c.expected)
+		}
+	}
+}
+
+func TestCancelAndResetRepJob(t *testing.T) {
+	job := models.RepJob{
+		Repository: "library/ubuntuf",
+		PolicyID:   policyID,
+		Operation:  "transfer",
+	}
+	id, err := AddRepJob(job)
+	if err != nil {
+		t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+	}
+	defer DeleteRepJob(id)
+
+	ok, err := ResetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to reset job: %d, error: %v", id, err)
+	}
+	if ok {
+		t.Errorf("The pending job: %d should not be reset", id)
+	}
+
+	ok, err = CancelRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to cancel job: %d, error: %v", id, err)
+	}
+	if !ok {
+		t.Errorf("The pending job: %d should be canceled", id)
+	}
+	j, err := GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Status != models.JobCanceled {
+		t.Errorf("The rep job: %d, status should be Canceled, but infact: %s", id, j.Status)
+	}
+
+	ok, err = CancelRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to cancel job: %d, error: %v", id, err)
+	}
+	if ok {
+		t.Errorf("The canceled job: %d should not be canceled again", id)
+	}
+
+	ok, err = ResetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to reset job: %d, error: %v", id, err)
+	}
+	if !ok {
+		t.Errorf("The canceled job: %d should be reset", id)
+	}
+	j, err = GetRepJob(id)
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", id, err)
+	}
+	if j.Status != models.JobPending {
+		t.Errorf("The rep job: %d, status should be Pending, but infact: %s", id, j.Status)
+	}
+}
+
+func TestPurgeRepJobs(t *testing.T) {
+	var ids []int64
+	for _, status := range []string{models.JobFinished, models.JobFinished, models.JobError, models.JobPending} {
+		job := models.RepJob{
+			Repository: "library/ubuntug",
+			PolicyID:   policyID,
+			Operation:  "transfer",
+			Status:     status,
+		}
+		id, err := AddRepJob(job)
+		if err != nil {
+			t.Fatalf("Failed to add job: %+v, error: %v", job, err)
+		}
+		ids = append(ids, id)
+	}
+	defer DeleteRepJobs(ids...)
+
+	expired, err := GetExpiredRepJobIDs(time.Now().Add(time.Minute), 0, 1000, models.JobError)
+	if err != nil {
+		t.Fatalf("Failed to get expired jobs, error: %v", err)
+	}
+	found := map[int64]bool{}
+	for _, id := range expired {
+		found[id] = true
+	}
+	if !found[ids[2]] || found[ids[0]] || found[ids[3]] {
+		t.Errorf("Unexpected expired jobs, only %d of the added jobs should be included, in fact: %v", ids[2], expired)
+	}
+
+	// the IDs are paged through in ascending order
+	expired, err = GetExpiredRepJobIDs(time.Now().Add(time.Minute), ids[0]-1, 1, models.JobFinished)
+	if err != nil {
+		t.Fatalf("Failed to get expired jobs, error: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != ids[0] {
+		t.Errorf("Unexpected first page of expired jobs, expected: [%d], in fact: %v", ids[0], expired)
+	}
+	expired, err = GetExpiredRepJobIDs(time.Now().Add(time.Minute), ids[0], 1, models.JobFinished)
+	if err != nil {
+		t.Fatalf("Failed to get expired jobs, error: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != ids[1] {
+		t.Errorf("Unexpected second page of expired jobs, expected: [%d], in fact: %v", ids[1], expired)
+	}
+
+	expired, err = GetExpiredRepJobIDs(time.Now().Add(-time.Hour), 0, 1000, models.JobFinished, models.JobError)
+	if err != nil {
+		t.Fatalf("Failed to get expired jobs, error: %v", err)
+	}
+	for _, id := range expired {
+		if id == ids[0] || id == ids[1] || id == ids[2] {
+			t.Errorf("The job: %d should not be expired", id)
+		}
+	}
+
+	policyIDs, err := GetRepJobPolicyIDs()
+	if err != nil {
+		t.Fatalf("Failed to get the policies of jobs, error: %v", err)
+	}
+	found = map[int64]bool{}
+	for _, id := range policyIDs {
+		found[id] = true
+	}
+	if !found[policyID] {
+		t.Errorf("Policy %d should have jobs, in fact: %v", policyID, policyIDs)
+	}
+
+	excess, err := GetExcessRepJobIDs(policyID, 1, 0, 1000, models.JobFinished)
+	if err != nil {
+		t.Fatalf("Failed to get excess jobs, error: %v", err)
+	}
+	found = map[int64]bool{}
+	for _, id := range excess {
+		found[id] = true
+	}
+	if !found[ids[0]] || found[ids[1]] {
+		t.Errorf("Unexpected excess jobs, %d should be included and %d should not, in fact: %v", ids[0], ids[1], excess)
+	}
+
+	// the jobs are deleted in batches
+	defer func(size int) {
+		deleteBatchSize = size
+	}(deleteBatchSize)
+	deleteBatchSize = 2
+	n, err := DeleteRepJobs(ids[:3]...)
+	if err != nil {
+		t.Fatalf("Failed to delete jobs, error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Unexpected count of deleted jobs, expected: 3, in fact: %d", n)
+	}
+	j, err := GetRepJob(ids[3])
+	if err != nil {
+		t.Fatalf("Failed to get rep job, id: %d, error: %v", ids[3], err)
+	}
+	if j == nil {
+		t.Errorf("The job: %d should not be deleted", ids[3])
 	}
 }
 
@@ -0,0 +1,57 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dao
+
+import (
+	"time"
+
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// AcquireLease acquires or renews the lease whose name is name for owner until leaseExpire,
+// it returns false if the lease is held by another owner and has not expired at now.
+func AcquireLease(name, owner string, leaseExpire, now time.Time) (bool, error) {
+	o := GetOrmer()
+	sql := `update lease set owner = ?, expire_time = ? 
+		where name = ? and (owner = ? or expire_time is null or expire_time <= ?)`
+	r, err := o.Raw(sql, owner, leaseExpire, name, owner, now).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		return true, nil
+	}
+
+	// the lease is created by the first owner, the insert fails if another
+	// owner has created it since it was updated
+	var count int64
+	if err = o.Raw(`select count(*) from lease where name = ?`, name).QueryRow(&count); err != nil {
+		return false, err
+	}
+	if count != 0 {
+		return false, nil
+	}
+	sql = `insert into lease (name, owner, expire_time) values (?, ?, ?)`
+	if _, err = o.Raw(sql, name, owner, leaseExpire).Exec(); err != nil {
+		log.Debugf("Failed to create lease %s for %s, error: %v", name, owner, err)
+		return false, nil
+	}
+	return true, nil
+}
@@ -16,6 +16,7 @@
 package dao
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 
 	"github.com/astaxie/beego/orm"
 	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
 )
 
 // AddRepTarget ...
@@ -69,7 +71,13 @@ func GetRepTargetByEndpoint(endpoint string) (*models.RepTarget, error) {
 // DeleteRepTarget ...
 func DeleteRepTarget(id int64) error {
 	o := GetOrmer()
-	_, err := o.Delete(&models.RepTarget{ID: id})
+	if _, err := o.Delete(&models.RepTarget{ID: id}); err != nil {
+		return err
+	}
+	if _, err := o.QueryTable(new(models.RepBlobLocation)).Filter("TargetID", id).Delete(); err != nil {
+		return err
+	}
+	_, err := o.QueryTable(new(models.RepTargetStatus)).Filter("TargetID", id).Delete()
 	return err
 }
 
@@ -77,7 +85,9 @@ func DeleteRepTarget(id int64) error {
 func UpdateRepTarget(target models.RepTarget) error {
 	o := GetOrmer()
 	target.UpdateTime = time.Now()
-	_, err := o.Update(&target, "URL", "Name", "Username", "Password", "UpdateTime")
+	_, err := o.Update(&target, "URL", "Name", "Username", "Password", "Type", "BandwidthLimit",
+		"Insecure", "CACert", "ClientCert", "ClientKey",
+		"ProxyURL", "ProxyUsername", "ProxyPassword", "NoProxy", "UpdateTime")
 	return err
 }
 
@@ -106,16 +116,24 @@ func FilterRepTargets(name string) ([]*models.RepTarget, error) {
 // AddRepPolicy ...
 func AddRepPolicy(policy models.RepPolicy) (int64, error) {
 	o := GetOrmer()
-	sql := `insert into replication_policy (name, project_id, target_id, enabled, description, cron_str, start_time, creation_time, update_time ) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sql := `insert into replication_policy (name, project_id, target_id, enabled, description, cron_str, direction, filters, time_windows, start_time, creation_time, update_time ) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	p, err := o.Raw(sql).Prepare()
 	if err != nil {
 		return 0, err
 	}
+	if err := genRulesStr(&policy); err != nil {
+		return 0, err
+	}
 
 	params := []interface{}{}
-	params = append(params, policy.Name, policy.ProjectID, policy.TargetID, policy.Enabled, policy.Description, policy.CronStr)
+	if len(policy.Direction) == 0 {
+		policy.Direction = models.RepDirectionPush
+	}
+	params = append(params, policy.Name, policy.ProjectID, policy.TargetID, policy.Enabled, policy.Description, policy.CronStr, policy.Direction, policy.FiltersStr, policy.WindowsStr)
 	now := time.Now()
-	if policy.Enabled == 1 {
+	if !policy.StartTime.IsZero() {
+		params = append(params, policy.StartTime)
+	} else if policy.Enabled == 1 {
 		params = append(params, now)
 	} else {
 		params = append(params, nil)
@@ -143,6 +161,7 @@ func GetRepPolicy(id int64) (*models.RepPolicy, error) {
 		}
 		return nil, err
 	}
+	genRulesForPolicy(&policy)
 
 	return &policy, nil
 }
@@ -155,7 +174,7 @@ func FilterRepPolicies(name string, projectID int64) ([]*models.RepPolicy, error
 
 	sql := `select rp.id, rp.project_id, p.name as project_name, rp.target_id, 
 				rt.name as target_name, rp.name, rp.enabled, rp.description,
-				rp.cron_str, rp.start_time, rp.creation_time, rp.update_time, 
+				rp.cron_str, rp.direction, rp.filters, rp.time_windows, rp.start_time, rp.next_run_time, rp.creation_time, rp.update_time, 
 				count(rj.status) as error_job_count 
 			from replication_policy rp 
 			left join project p on rp.project_id=p.project_id 
@@ -182,6 +201,7 @@ func FilterRepPolicies(name string, projectID int64) ([]*models.RepPolicy, error
 	if _, err := o.Raw(sql, args).QueryRows(&policies); err != nil {
 		return nil, err
 	}
+	genRulesForPolicy(policies...)
 	return policies, nil
 }
 
@@ -198,6 +218,7 @@ func GetRepPolicyByName(name string) (*models.RepPolicy, error) {
 		}
 		return nil, err
 	}
+	genRulesForPolicy(&policy)
 
 	return &policy, nil
 }
@@ -212,6 +233,7 @@ func GetRepPolicyByProject(projectID int64) ([]*models.RepPolicy, error) {
 	if _, err := o.Raw(sql, projectID).QueryRows(&policies); err != nil {
 		return nil, err
 	}
+	genRulesForPolicy(policies...)
 
 	return policies, nil
 }
@@ -226,6 +248,7 @@ func GetRepPolicyByTarget(targetID int64) ([]*models.RepPolicy, error) {
 	if _, err := o.Raw(sql, targetID).QueryRows(&policies); err != nil {
 		return nil, err
 	}
+	genRulesForPolicy(policies...)
 
 	return policies, nil
 }
@@ -240,6 +263,7 @@ func GetRepPolicyByProjectAndTarget(projectID, targetID int64) ([]*models.RepPol
 	if _, err := o.Raw(sql, projectID, targetID).QueryRows(&policies); err != nil {
 		return nil, err
 	}
+	genRulesForPolicy(policies...)
 
 	return policies, nil
 }
@@ -248,10 +272,62 @@ func GetRepPolicyByProjectAndTarget(projectID, targetID int64) ([]*models.RepPol
 func UpdateRepPolicy(policy *models.RepPolicy) error {
 	o := GetOrmer()
 	policy.UpdateTime = time.Now()
-	_, err := o.Update(policy, "TargetID", "Name", "Enabled", "Description", "CronStr", "UpdateTime")
+	if err := genRulesStr(policy); err != nil {
+		return err
+	}
+	_, err := o.Update(policy, "TargetID", "Name", "Enabled", "Description", "CronStr", "FiltersStr", "WindowsStr", "StartTime", "UpdateTime")
+	return err
+}
+
+// UpdateRepPolicyNextRunTime records the next run time of the policy, zero means
+// the policy is not scheduled. The update time of the policy is not changed.
+func UpdateRepPolicyNextRunTime(id int64, next time.Time) error {
+	var value interface{}
+	if !next.IsZero() {
+		value = next
+	}
+	_, err := GetOrmer().Raw(`update replication_policy set next_run_time = ?, update_time = update_time 
+		where id = ?`, value, id).Exec()
 	return err
 }
 
+// GetScheduledRepPolicies returns the enabled policies which have cron string
+func GetScheduledRepPolicies() ([]*models.RepPolicy, error) {
+	o := GetOrmer()
+	sql := `select * from replication_policy where deleted = 0 and enabled = 1 and cron_str is not null and cron_str != ''`
+
+	var policies []*models.RepPolicy
+
+	if _, err := o.Raw(sql).QueryRows(&policies); err != nil {
+		return nil, err
+	}
+	genRulesForPolicy(policies...)
+
+	return policies, nil
+}
+
+// GetRepPolicyIDs returns the IDs of all policies which have not been deleted
+func GetRepPolicyIDs() ([]int64, error) {
+	ids := []int64{}
+	_, err := GetOrmer().Raw(`select id from replication_policy where deleted = 0`).QueryRows(&ids)
+	return ids, err
+}
+
+// GetWindowedRepPolicies returns the policies which have time windows
+func GetWindowedRepPolicies() ([]*models.RepPolicy, error) {
+	o := GetOrmer()
+	sql := `select * from replication_policy where deleted = 0 and time_windows is not null and time_windows != ''`
+
+	var policies []*models.RepPolicy
+
+	if _, err := o.Raw(sql).QueryRows(&policies); err != nil {
+		return nil, err
+	}
+	genRulesForPolicy(policies...)
+
+	return policies, nil
+}
+
 // DeleteRepPolicy ...
 func DeleteRepPolicy(id int64) error {
 	o := GetOrmer()
@@ -300,12 +376,85 @@ func AddRepJob(job models.RepJob) (int64, error) {
 	if len(job.Status) == 0 {
 		job.Status = models.JobPending
 	}
+	if len(job.Kind) == 0 {
+		job.Kind = models.JobKindReplication
+	}
 	if len(job.TagList) > 0 {
 		job.Tags = strings.Join(job.TagList, ",")
 	}
 	return o.Insert(&job)
 }
 
+// AddOrMergeRepJob adds the job, or merges it into the latest job of the same policy
+// and repository if that job has the same operation and is pending without having been
+// started. Only the jobs which are not pinned to a digest, or which are pinned to the
+// same digest of the same tag, are merged. The tags of the merged job are the union of
+// both, and it replicates all tags if either of them does. It returns the ID of the job
+// and whether the job is merged.
+func AddOrMergeRepJob(job models.RepJob) (int64, bool, error) {
+	o := GetOrmer()
+	latest := models.RepJob{}
+	err := o.QueryTable(&latest).Filter("PolicyID", job.PolicyID).
+		Filter("Repository", job.Repository).OrderBy("-ID").Limit(1).One(&latest)
+	if err != nil && err != orm.ErrNoRows {
+		return 0, false, err
+	}
+
+	if err == nil && latest.Status == models.JobPending &&
+		latest.Operation == job.Operation && len(latest.ProgressStr) == 0 {
+		genTagListForJob(&latest)
+		if tags, ok := mergeTags(&latest, &job); ok {
+			// the status is checked again to make sure the job has not been claimed
+			// since it was selected
+			sql := `update replication_job set tags = ?, update_time = ? 
+				where id = ? and status = ?`
+			r, err := o.Raw(sql, strings.Join(tags, ","), time.Now(),
+				latest.ID, models.JobPending).Exec()
+			if err != nil {
+				return 0, false, err
+			}
+			n, err := r.RowsAffected()
+			if err != nil {
+				return 0, false, err
+			}
+			if n == 1 {
+				return latest.ID, true, nil
+			}
+		}
+	}
+
+	id, err := AddRepJob(job)
+	return id, false, err
+}
+
+// mergeTags returns the tags of the job merged from the pending job p and the new
+// job j, and whether they can be merged. The jobs pinned to different digests can
+// not be merged, and as a digest only pins a single tag, neither can the jobs pinned
+// to the same digest of different tags.
+func mergeTags(p, j *models.RepJob) ([]string, bool) {
+	if p.Digest != j.Digest {
+		return nil, false
+	}
+	if len(p.TagList) == 0 || len(j.TagList) == 0 {
+		return []string{}, len(j.Digest) == 0
+	}
+	tags := append([]string{}, p.TagList...)
+	existing := map[string]bool{}
+	for _, tag := range tags {
+		existing[tag] = true
+	}
+	for _, tag := range j.TagList {
+		if !existing[tag] {
+			tags = append(tags, tag)
+			existing[tag] = true
+		}
+	}
+	if len(j.Digest) != 0 && len(tags) != 1 {
+		return nil, false
+	}
+	return tags, true
+}
+
 // GetRepJob ...
 func GetRepJob(id int64) (*models.RepJob, error) {
 	o := GetOrmer()
@@ -315,6 +464,7 @@ func GetRepJob(id int64) (*models.RepJob, error) {
 		return nil, nil
 	}
 	genTagListForJob(&j)
+	genProgressForJob(&j)
 	return &j, nil
 }
 
@@ -327,7 +477,7 @@ func GetRepJobByPolicy(policyID int64) ([]*models.RepJob, error) {
 }
 
 // FilterRepJobs ...
-func FilterRepJobs(policyID int64, repository, status string, startTime,
+func FilterRepJobs(policyID, executionID int64, repository, status string, startTime,
 	endTime *time.Time, limit, offset int64) ([]*models.RepJob, int64, error) {
 
 	jobs := []*models.RepJob{}
@@ -337,6 +487,9 @@ func FilterRepJobs(policyID int64, repository, status string, startTime,
 	if policyID != 0 {
 		qs = qs.Filter("PolicyID", policyID)
 	}
+	if executionID != 0 {
+		qs = qs.Filter("ExecutionID", executionID)
+	}
 	if len(repository) != 0 {
 		qs = qs.Filter("Repository__icontains", repository)
 	}
@@ -363,6 +516,7 @@ func FilterRepJobs(policyID int64, repository, status string, startTime,
 	}
 
 	genTagListForJob(jobs...)
+	genProgressForJob(jobs...)
 
 	return jobs, total, nil
 }
@@ -387,10 +541,119 @@ func repJobPolicyIDQs(policyID int64) orm.QuerySeter {
 // DeleteRepJob ...
 func DeleteRepJob(id int64) error {
 	o := GetOrmer()
+	if _, err := o.QueryTable(new(models.RepJobAttempt)).Filter("JobID", id).Delete(); err != nil {
+		return err
+	}
 	_, err := o.Delete(&models.RepJob{ID: id})
 	return err
 }
 
+// the max count of jobs deleted by a statement, so the statements do not exceed
+// the limit of placeholders or the size of packets
+var deleteBatchSize = 1000
+
+// DeleteRepJobs deletes the jobs and their attempts, the executions left without jobs
+// are also deleted. The jobs are deleted in batches. It returns the count of jobs deleted
+func DeleteRepJobs(ids ...int64) (int64, error) {
+	var total int64
+	for len(ids) > 0 {
+		count := len(ids)
+		if count > deleteBatchSize {
+			count = deleteBatchSize
+		}
+		n, err := deleteRepJobs(ids[:count])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		ids = ids[count:]
+	}
+	return total, nil
+}
+
+func deleteRepJobs(ids []int64) (int64, error) {
+	o := GetOrmer()
+	var executionIDs []int64
+	sql := `select distinct execution_id from replication_job 
+		where execution_id != 0 and id in (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	params := []interface{}{}
+	for _, id := range ids {
+		params = append(params, id)
+	}
+	if _, err := o.Raw(sql, params...).QueryRows(&executionIDs); err != nil {
+		return 0, err
+	}
+
+	if _, err := o.QueryTable(new(models.RepJobAttempt)).Filter("JobID__in", ids).Delete(); err != nil {
+		return 0, err
+	}
+	n, err := repJobQs().Filter("id__in", ids).Delete()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range executionIDs {
+		count, err := repJobQs().Filter("execution_id", id).Count()
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			if err = DeleteRepExecution(id); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// GetExpiredRepJobIDs returns the IDs of jobs of certain statuses which have not
+// been updated since before, at most limit IDs greater than afterID are returned
+// in ascending order so the IDs can be paged through
+func GetExpiredRepJobIDs(before time.Time, afterID int64, limit int, status ...string) ([]int64, error) {
+	var jobs []*models.RepJob
+	if _, err := repJobQs().Filter("status__in", status).Filter("update_time__lt", before).
+		Filter("id__gt", afterID).OrderBy("ID").Limit(limit).All(&jobs, "ID"); err != nil {
+		return nil, err
+	}
+	return repJobIDs(jobs), nil
+}
+
+// GetRepJobPolicyIDs returns the IDs of the policies which have jobs
+func GetRepJobPolicyIDs() ([]int64, error) {
+	var policyIDs []int64
+	_, err := GetOrmer().Raw(`select distinct policy_id from replication_job`).QueryRows(&policyIDs)
+	return policyIDs, err
+}
+
+// GetExcessRepJobIDs returns the IDs of jobs of certain statuses of the policy except
+// the latest keep ones, at most limit IDs greater than afterID are returned in
+// ascending order so the IDs can be paged through
+func GetExcessRepJobIDs(policyID int64, keep int, afterID int64, limit int, status ...string) ([]int64, error) {
+	var kept []*models.RepJob
+	if _, err := repJobPolicyIDQs(policyID).Filter("status__in", status).
+		OrderBy("-UpdateTime", "-ID").Limit(keep).All(&kept, "ID"); err != nil {
+		return nil, err
+	}
+
+	qs := repJobPolicyIDQs(policyID).Filter("status__in", status).Filter("id__gt", afterID)
+	if len(kept) > 0 {
+		qs = qs.Exclude("id__in", repJobIDs(kept))
+	}
+	var jobs []*models.RepJob
+	if _, err := qs.OrderBy("ID").Limit(limit).All(&jobs, "ID"); err != nil {
+		return nil, err
+	}
+	return repJobIDs(jobs), nil
+}
+
+func repJobIDs(jobs []*models.RepJob) []int64 {
+	ids := []int64{}
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
 // UpdateRepJobStatus ...
 func UpdateRepJobStatus(id int64, status string) error {
 	o := GetOrmer()
@@ -406,14 +669,402 @@ func UpdateRepJobStatus(id int64, status string) error {
 	return err
 }
 
-// ResetRunningJobs update all running jobs status to pending
-func ResetRunningJobs() error {
+// CancelRepJob updates the status of a job to canceled if it has not been claimed
+// by job service, it returns false if the job is not pending or retrying.
+func CancelRepJob(id int64) (bool, error) {
 	o := GetOrmer()
-	sql := fmt.Sprintf("update replication_job set status = '%s', update_time = ? where status = '%s'", models.JobPending, models.JobRunning)
-	_, err := o.Raw(sql, time.Now()).Exec()
+	sql := `update replication_job set status = ?, update_time = ? 
+		where id = ? and (status = ? or status = ?)`
+	r, err := o.Raw(sql, models.JobCanceled, time.Now(), id,
+		models.JobPending, models.JobRetrying).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ResetRepJob puts a job which has completed back to the job queue, its retries,
+// attempts and progress are cleared. It returns false if the job has not completed.
+func ResetRepJob(id int64) (bool, error) {
+	o := GetOrmer()
+	sql := `update replication_job set status = ?, retry_count = 0, next_attempt_time = null, 
+		progress = null, update_time = ? 
+		where id = ? and status in (?, ?, ?, ?)`
+	r, err := o.Raw(sql, models.JobPending, time.Now(), id, models.JobFinished,
+		models.JobError, models.JobStopped, models.JobCanceled).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	_, err = o.QueryTable(new(models.RepJobAttempt)).Filter("JobID", id).Delete()
+	return true, err
+}
+
+// UpdateRepJobProgress persists the progress of a job
+func UpdateRepJobProgress(id int64, progress *models.RepJobProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	o := GetOrmer()
+	_, err = o.Raw(`update replication_job set progress = ? where id = ?`, string(data), id).Exec()
+	return err
+}
+
+// UpdateRepJobDigest records the digest of the manifest replicated by the job
+func UpdateRepJobDigest(id int64, digest string) error {
+	o := GetOrmer()
+	_, err := o.Raw(`update replication_job set digest = ? where id = ?`, digest, id).Exec()
 	return err
 }
 
+// UpdateRepJobRetry updates the status of a job to retrying, and records the
+// count of retries and the time of its next attempt
+func UpdateRepJobRetry(id int64, retryCount int, nextAttempt time.Time) error {
+	o := GetOrmer()
+	j := models.RepJob{
+		ID:              id,
+		Status:          models.JobRetrying,
+		RetryCount:      retryCount,
+		NextAttemptTime: nextAttempt,
+		UpdateTime:      time.Now(),
+	}
+	num, err := o.Update(&j, "Status", "RetryCount", "NextAttemptTime", "UpdateTime")
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return fmt.Errorf("Failed to update replication job with id: %d", id)
+	}
+	return nil
+}
+
+// UpdateRepJobRetryCount records the count of retries of a job whose retries are
+// exhausted, the status of the job is updated when it enters the error state
+func UpdateRepJobRetryCount(id int64, retryCount int) error {
+	o := GetOrmer()
+	j := models.RepJob{
+		ID:         id,
+		RetryCount: retryCount,
+		UpdateTime: time.Now(),
+	}
+	num, err := o.Update(&j, "RetryCount", "UpdateTime")
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return fmt.Errorf("Failed to update replication job with id: %d", id)
+	}
+	return nil
+}
+
+// AddRepJobAttempt ...
+func AddRepJobAttempt(attempt models.RepJobAttempt) (int64, error) {
+	o := GetOrmer()
+	return o.Insert(&attempt)
+}
+
+// GetRepJobAttempts returns the failed attempts of jobs, ordered by attempt
+func GetRepJobAttempts(jobIDs ...int64) ([]*models.RepJobAttempt, error) {
+	attempts := []*models.RepJobAttempt{}
+	if len(jobIDs) == 0 {
+		return attempts, nil
+	}
+
+	_, err := GetOrmer().QueryTable(new(models.RepJobAttempt)).
+		Filter("JobID__in", jobIDs).OrderBy("JobID", "Attempt").All(&attempts)
+	return attempts, err
+}
+
+// GetRepBlobLocation returns the repository of the target in which the blob is known to exist
+func GetRepBlobLocation(targetID int64, digest string) (*models.RepBlobLocation, error) {
+	location := models.RepBlobLocation{}
+	err := GetOrmer().QueryTable(&location).Filter("TargetID", targetID).
+		Filter("Digest", digest).One(&location)
+	if err == orm.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// SetRepBlobLocation records that the blob exists in the repository of the target,
+// it replaces the repository recorded before.
+func SetRepBlobLocation(targetID int64, digest, repository string) error {
+	o := GetOrmer()
+	num, err := o.QueryTable(new(models.RepBlobLocation)).Filter("TargetID", targetID).
+		Filter("Digest", digest).Update(orm.Params{
+		"Repository": repository,
+		"UpdateTime": time.Now(),
+	})
+	if err != nil || num > 0 {
+		return err
+	}
+	_, err = o.Insert(&models.RepBlobLocation{
+		TargetID:   targetID,
+		Digest:     digest,
+		Repository: repository,
+	})
+	return err
+}
+
+// DeleteRepBlobLocation removes the location of the blob on the target
+func DeleteRepBlobLocation(targetID int64, digest string) error {
+	_, err := GetOrmer().QueryTable(new(models.RepBlobLocation)).Filter("TargetID", targetID).
+		Filter("Digest", digest).Delete()
+	return err
+}
+
+// AddRepExecution ...
+func AddRepExecution(execution models.RepExecution) (int64, error) {
+	return GetOrmer().Insert(&execution)
+}
+
+// GetRepExecution returns the execution with the counts of its jobs
+func GetRepExecution(id int64) (*models.RepExecution, error) {
+	execution := models.RepExecution{ID: id}
+	err := GetOrmer().Read(&execution)
+	if err == orm.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = genJobCountsForExecution(&execution); err != nil {
+		return nil, err
+	}
+	return &execution, nil
+}
+
+// FilterRepExecutions returns the executions of the policy with the counts of their
+// jobs, the latest first
+func FilterRepExecutions(policyID, limit, offset int64) ([]*models.RepExecution, int64, error) {
+	executions := []*models.RepExecution{}
+	qs := GetOrmer().QueryTable(new(models.RepExecution)).Filter("PolicyID", policyID)
+
+	total, err := qs.Count()
+	if err != nil {
+		return executions, 0, err
+	}
+
+	if _, err = qs.OrderBy("-ID").Limit(limit).Offset(offset).All(&executions); err != nil {
+		return executions, 0, err
+	}
+
+	if err = genJobCountsForExecution(executions...); err != nil {
+		return executions, 0, err
+	}
+	return executions, total, nil
+}
+
+// DeleteRepExecution ...
+func DeleteRepExecution(id int64) error {
+	_, err := GetOrmer().Delete(&models.RepExecution{ID: id})
+	return err
+}
+
+// GetRepJobsByExecution returns the jobs of the execution in the status
+func GetRepJobsByExecution(executionID int64, status string) ([]*models.RepJob, error) {
+	jobs := []*models.RepJob{}
+	_, err := GetOrmer().QueryTable(new(models.RepJob)).Filter("ExecutionID", executionID).
+		Filter("Status", status).OrderBy("ID").All(&jobs)
+	if err != nil {
+		return nil, err
+	}
+	genTagListForJob(jobs...)
+	return jobs, nil
+}
+
+// genJobCountsForExecution counts the jobs of the executions by status, and sets the
+// end time of the executions whose jobs have all completed
+func genJobCountsForExecution(executions ...*models.RepExecution) error {
+	if len(executions) == 0 {
+		return nil
+	}
+
+	params := []interface{}{}
+	m := map[int64]*models.RepExecution{}
+	for _, execution := range executions {
+		params = append(params, execution.ID)
+		m[execution.ID] = execution
+	}
+
+	counts := []*models.RepExecutionJobCount{}
+	sql := `select execution_id, status, count(*) as count from replication_job 
+		where execution_id in (?` + strings.Repeat(", ?", len(executions)-1) + `) 
+		group by execution_id, status`
+	if _, err := GetOrmer().Raw(sql, params...).QueryRows(&counts); err != nil {
+		return err
+	}
+	for _, count := range counts {
+		m[count.ExecutionID].AddJobCount(count.Status, count.Count)
+	}
+
+	for _, execution := range executions {
+		if execution.Total == 0 {
+			execution.Status = models.RepExecutionSucceeded
+			execution.EndTime = &execution.StartTime
+			continue
+		}
+		if execution.InProgress > 0 {
+			continue
+		}
+		last := models.RepJob{}
+		if err := GetOrmer().QueryTable(&last).Filter("ExecutionID", execution.ID).
+			OrderBy("-UpdateTime").Limit(1).One(&last); err != nil {
+			return err
+		}
+		execution.EndTime = &last.UpdateTime
+	}
+	return nil
+}
+
+// CountQueuedRepJobs returns the count of jobs which are pending or retrying,
+// grouped by policy, target, operation and status
+func CountQueuedRepJobs() ([]*models.RepJobCount, error) {
+	counts := []*models.RepJobCount{}
+	sql := `select j.policy_id, p.target_id, j.operation, j.status, count(*) as count
+		from replication_job j left join replication_policy p on j.policy_id = p.id
+		where j.status in (?, ?)
+		group by j.policy_id, p.target_id, j.operation, j.status`
+	_, err := GetOrmer().Raw(sql, models.JobPending, models.JobRetrying).QueryRows(&counts)
+	return counts, err
+}
+
+// ClaimRepJob picks the oldest job which is pending, or is retrying and whose
+// next attempt is due at now, marks it as running and leases it to owner
+// until leaseExpire. The jobs of the excluded policies are not picked, and
+// the replication jobs of a policy for a repository are picked one by one in
+// the order they are created, e.g. a delete job is never overtaken by an
+// earlier transfer job, while the jobs of other kinds are not ordered. It
+// returns 0 if there is no job can be claimed.
+func ClaimRepJob(owner string, leaseExpire, now time.Time, excludedPolicies ...int64) (int64, error) {
+	o := GetOrmer()
+	for {
+		var ids []int64
+		sql := `select j.id from replication_job j 
+			where (j.status = ? or (j.status = ? and (j.next_attempt_time is null or j.next_attempt_time <= ?))) 
+			and (j.kind != ? or not exists (select 1 from replication_job e 
+				where e.kind = j.kind and e.policy_id = j.policy_id and e.repository = j.repository 
+				and (e.status = ? or (e.id < j.id and (e.status = ? or e.status = ?))))) `
+		params := []interface{}{models.JobPending, models.JobRetrying, now, models.JobKindReplication,
+			models.JobRunning, models.JobPending, models.JobRetrying}
+		if len(excludedPolicies) != 0 {
+			sql += `and j.policy_id not in (?` + strings.Repeat(", ?", len(excludedPolicies)-1) + `) `
+			for _, id := range excludedPolicies {
+				params = append(params, id)
+			}
+		}
+		sql += `order by j.id limit 1`
+		if _, err := o.Raw(sql, params...).QueryRows(&ids); err != nil {
+			return 0, err
+		}
+		if len(ids) == 0 {
+			return 0, nil
+		}
+
+		// the status is checked again to make sure the job has not been
+		// claimed by others since it was selected
+		sql = `update replication_job 
+			set status = ?, lease_owner = ?, lease_expire_time = ?, update_time = ? 
+			where id = ? and (status = ? or status = ?)`
+		r, err := o.Raw(sql, models.JobRunning, owner, leaseExpire, time.Now(),
+			ids[0], models.JobPending, models.JobRetrying).Exec()
+		if err != nil {
+			return 0, err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 1 {
+			return ids[0], nil
+		}
+	}
+}
+
+// RenewRepJobLease extends the lease of a running job held by owner
+func RenewRepJobLease(id int64, owner string, leaseExpire time.Time) error {
+	o := GetOrmer()
+	sql := `update replication_job set lease_expire_time = ? 
+		where id = ? and lease_owner = ? and status = ?`
+	r, err := o.Raw(sql, leaseExpire, id, owner, models.JobRunning).Exec()
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("job %d is not running or not leased to %s", id, owner)
+	}
+	return nil
+}
+
+// ReleaseExpiredRepJobs updates the status of running jobs whose lease has
+// expired before t to pending, so they can be claimed again. The running jobs
+// without lease are released as well, the schema migration to 0.5.0 puts the
+// running jobs left before the upgrade back to pending, this catches the ones
+// missed by it.
+func ReleaseExpiredRepJobs(t time.Time) (int64, error) {
+	o := GetOrmer()
+	sql := `update replication_job set status = ?, lease_owner = null, 
+		lease_expire_time = null, update_time = ? 
+		where status = ? and (lease_expire_time is null or lease_expire_time < ?)`
+	r, err := o.Raw(sql, models.JobPending, time.Now(), models.JobRunning, t).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// ReleaseRepJob updates the status of a running job leased to owner to pending
+func ReleaseRepJob(id int64, owner string) error {
+	o := GetOrmer()
+	sql := `update replication_job set status = ?, lease_owner = null, 
+		lease_expire_time = null, update_time = ? 
+		where id = ? and status = ? and lease_owner = ?`
+	r, err := o.Raw(sql, models.JobPending, time.Now(), id, models.JobRunning, owner).Exec()
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("job %d is not running or not leased to %s", id, owner)
+	}
+	return nil
+}
+
+// ReleaseRepJobsByOwner updates the status of running jobs leased to owner to pending
+func ReleaseRepJobsByOwner(owner string) (int64, error) {
+	o := GetOrmer()
+	sql := `update replication_job set status = ?, lease_owner = null, 
+		lease_expire_time = null, update_time = ? 
+		where status = ? and lease_owner = ?`
+	r, err := o.Raw(sql, models.JobPending, time.Now(), models.JobRunning, owner).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
 // GetRepJobByStatus get jobs of certain statuses
 func GetRepJobByStatus(status ...string) ([]*models.RepJob, error) {
 	var res []*models.RepJob
@@ -433,3 +1084,131 @@ func genTagListForJob(jobs ...*models.RepJob) {
 		}
 	}
 }
+
+func genProgressForJob(jobs ...*models.RepJob) {
+	for _, j := range jobs {
+		if len(j.ProgressStr) == 0 {
+			continue
+		}
+		p := &models.RepJobProgress{}
+		if err := json.Unmarshal([]byte(j.ProgressStr), p); err != nil {
+			log.Warningf("failed to parse progress of job %d: %v", j.ID, err)
+			continue
+		}
+		j.Progress = p
+	}
+}
+
+// genRulesForPolicy parses the filters and time windows of the policies
+func genRulesForPolicy(policies ...*models.RepPolicy) {
+	for _, p := range policies {
+		if len(p.FiltersStr) != 0 {
+			filters := []*models.RepFilter{}
+			if err := json.Unmarshal([]byte(p.FiltersStr), &filters); err != nil {
+				log.Warningf("failed to parse filters of policy %d: %v", p.ID, err)
+			} else {
+				p.Filters = filters
+			}
+		}
+		if len(p.WindowsStr) != 0 {
+			windows := []*models.RepTimeWindow{}
+			if err := json.Unmarshal([]byte(p.WindowsStr), &windows); err != nil {
+				log.Warningf("failed to parse time windows of policy %d: %v", p.ID, err)
+			} else {
+				p.Windows = windows
+			}
+		}
+	}
+}
+
+// genRulesStr encodes the filters and time windows of the policy to be stored
+func genRulesStr(policy *models.RepPolicy) error {
+	policy.FiltersStr = ""
+	if len(policy.Filters) != 0 {
+		b, err := json.Marshal(policy.Filters)
+		if err != nil {
+			return err
+		}
+		policy.FiltersStr = string(b)
+	}
+
+	policy.WindowsStr = ""
+	if len(policy.Windows) != 0 {
+		b, err := json.Marshal(policy.Windows)
+		if err != nil {
+			return err
+		}
+		policy.WindowsStr = string(b)
+	}
+	return nil
+}
+
+// AddRepTargetStatus records the result of a health check of a target
+func AddRepTargetStatus(status models.RepTargetStatus) (int64, error) {
+	return GetOrmer().Insert(&status)
+}
+
+// GetLatestRepTargetStatuses returns the results of the latest health checks of the
+// targets, the ones of all targets are returned if no target is specified
+func GetLatestRepTargetStatuses(targetIDs ...int64) ([]*models.RepTargetStatus, error) {
+	sql := `select * from replication_target_status
+		where id in (select max(id) from replication_target_status group by target_id)`
+	args := []interface{}{}
+	if len(targetIDs) > 0 {
+		sql += ` and target_id in (?` + strings.Repeat(", ?", len(targetIDs)-1) + `)`
+		for _, id := range targetIDs {
+			args = append(args, id)
+		}
+	}
+
+	statuses := []*models.RepTargetStatus{}
+	_, err := GetOrmer().Raw(sql, args...).QueryRows(&statuses)
+	return statuses, err
+}
+
+// GetUnreachableRepPolicyIDs returns the IDs of the policies whose targets were unreachable
+// at their latest health checks made since the time
+func GetUnreachableRepPolicyIDs(since time.Time) ([]int64, error) {
+	sql := `select p.id from replication_policy p 
+		join replication_target_status s on s.target_id = p.target_id 
+		where p.deleted = 0 and s.reachable = 0 and s.check_time >= ? 
+		and s.id in (select max(id) from replication_target_status group by target_id)`
+
+	ids := []int64{}
+	_, err := GetOrmer().Raw(sql, since).QueryRows(&ids)
+	return ids, err
+}
+
+// FilterRepTargetStatuses returns the results of the health checks of the target,
+// the latest first, and the total count of the results
+func FilterRepTargetStatuses(targetID, limit, offset int64) ([]*models.RepTargetStatus, int64, error) {
+	statuses := []*models.RepTargetStatus{}
+	qs := GetOrmer().QueryTable(new(models.RepTargetStatus)).Filter("TargetID", targetID)
+
+	total, err := qs.Count()
+	if err != nil {
+		return statuses, 0, err
+	}
+
+	_, err = qs.OrderBy("-ID").Limit(limit).Offset(offset).All(&statuses)
+	return statuses, total, err
+}
+
+// DeleteRepTargetStatuses deletes the results of the health checks made before the
+// time, the latest result of each target is kept
+func DeleteRepTargetStatuses(before time.Time) (int64, error) {
+	latest, err := GetLatestRepTargetStatuses()
+	if err != nil {
+		return 0, err
+	}
+
+	qs := GetOrmer().QueryTable(new(models.RepTargetStatus)).Filter("CheckTime__lt", before)
+	if len(latest) > 0 {
+		ids := []int64{}
+		for _, status := range latest {
+			ids = append(ids, status.ID)
+		}
+		qs = qs.Exclude("ID__in", ids)
+	}
+	return qs.Delete()
+}
@@ -23,6 +23,10 @@ func init() {
 	orm.RegisterModel(new(RepTarget),
 		new(RepPolicy),
 		new(RepJob),
+		new(RepExecution),
+		new(RepJobAttempt),
+		new(RepBlobLocation),
+		new(RepTargetStatus),
 		new(User),
 		new(Project),
 		new(Role),
@@ -2,8 +2,113 @@ package models
 
 import (
 	"testing"
+	"time"
 )
 
 func TestMain(t *testing.T) {
 }
 
+
+func TestRepPolicyFilters(t *testing.T) {
+	policy := &RepPolicy{
+		Filters: []*RepFilter{
+			&RepFilter{Kind: RepFilterKindRepository, Type: RepFilterTypeGlob, Pattern: "app-*"},
+			&RepFilter{Kind: RepFilterKindRepository, Type: RepFilterTypeRegex, Pattern: "app-(test|dev)", Exclude: true},
+			&RepFilter{Kind: RepFilterKindTag, Type: RepFilterTypeGlob, Pattern: "release-*"},
+		},
+	}
+
+	cases := map[string]bool{
+		"library/app-web":  true,
+		"library/app-test": false,
+		"library/ubuntu":   false,
+	}
+	for repo, expected := range cases {
+		if matched := policy.MatchRepository(repo); matched != expected {
+			t.Errorf("unexpected result for %s: %v != %v", repo, matched, expected)
+		}
+	}
+
+	tags := policy.FilterTags([]string{"latest", "release-1.0", "release-1.1"})
+	if len(tags) != 2 || tags[0] != "release-1.0" || tags[1] != "release-1.1" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	if !(&RepPolicy{}).MatchRepository("library/ubuntu") {
+		t.Errorf("repository should be selected by the policy without filters")
+	}
+
+	invalid := &RepFilter{Kind: RepFilterKindTag, Type: RepFilterTypeRegex, Pattern: "release-("}
+	if err := invalid.validate(); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+}
+
+func TestRepPolicyInWindow(t *testing.T) {
+	policy := &RepPolicy{
+		Windows: []*RepTimeWindow{
+			// the night of weekdays
+			&RepTimeWindow{Start: "22:00", End: "06:00", Weekdays: []time.Weekday{
+				time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+			&RepTimeWindow{Start: "12:00", End: "13:00"},
+		},
+	}
+
+	// 2016-10-03 is Monday
+	cases := map[string]bool{
+		"2016-10-03 23:00": true,
+		"2016-10-04 05:59": true,
+		"2016-10-04 06:00": false,
+		"2016-10-04 12:30": true,
+		"2016-10-08 23:00": false, // Saturday
+		"2016-10-08 05:00": true,  // the window opened on Friday
+		"2016-10-09 05:00": false,
+	}
+	for clock, expected := range cases {
+		now, err := time.Parse("2006-01-02 15:04", clock)
+		if err != nil {
+			t.Fatalf("failed to parse time %s: %v", clock, err)
+		}
+		if in := policy.InWindow(now); in != expected {
+			t.Errorf("unexpected result for %s: %v != %v", clock, in, expected)
+		}
+	}
+
+	if !(&RepPolicy{}).InWindow(time.Now()) {
+		t.Errorf("the policy without time windows should be in window at any time")
+	}
+
+	invalid := []*RepTimeWindow{
+		&RepTimeWindow{Start: "25:00", End: "06:00"},
+		&RepTimeWindow{Start: "06:00", End: "06:00"},
+		&RepTimeWindow{Start: "06:00", End: "07:00", Weekdays: []time.Weekday{7}},
+	}
+	for _, w := range invalid {
+		if err := w.validate(); err == nil {
+			t.Errorf("expected error for invalid time window %+v", w)
+		}
+	}
+}
+
+func TestRepExecutionAddJobCount(t *testing.T) {
+	e := &RepExecution{}
+	e.AddJobCount(JobFinished, 2)
+	if e.Status != RepExecutionSucceeded {
+		t.Errorf("unexpected status: %s != %s", e.Status, RepExecutionSucceeded)
+	}
+	e.AddJobCount(JobCanceled, 1)
+	if e.Status != RepExecutionStopped {
+		t.Errorf("unexpected status: %s != %s", e.Status, RepExecutionStopped)
+	}
+	e.AddJobCount(JobError, 1)
+	if e.Status != RepExecutionFailed {
+		t.Errorf("unexpected status: %s != %s", e.Status, RepExecutionFailed)
+	}
+	e.AddJobCount(JobRetrying, 1)
+	if e.Status != RepExecutionInProgress {
+		t.Errorf("unexpected status: %s != %s", e.Status, RepExecutionInProgress)
+	}
+	if e.Total != 5 || e.Succeeded != 2 || e.Stopped != 1 || e.Failed != 1 || e.InProgress != 1 {
+		t.Errorf("unexpected counts: %+v", e)
+	}
+}
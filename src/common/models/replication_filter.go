@@ -0,0 +1,129 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	//RepFilterKindRepository represents a filter on the name of repository, the name of project is not included.
+	RepFilterKindRepository string = "repository"
+	//RepFilterKindTag represents a filter on the name of tag.
+	RepFilterKindTag string = "tag"
+	//RepFilterTypeGlob represents a filter whose pattern is a shell glob, e.g. "release-*".
+	RepFilterTypeGlob string = "glob"
+	//RepFilterTypeRegex represents a filter whose pattern is a regular expression, it must match the whole name.
+	RepFilterTypeRegex string = "regex"
+)
+
+// RepFilter is a rule which selects the repositories or tags a policy replicates.
+// A name is selected if it matches one of the including filters of its kind, or there
+// is no including filter of its kind, and it matches none of the excluding filters.
+type RepFilter struct {
+	Kind    string `json:"kind"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+	Exclude bool   `json:"exclude"`
+}
+
+// validate checks the kind, type and pattern of the filter
+func (f *RepFilter) validate() error {
+	if f.Kind != RepFilterKindRepository && f.Kind != RepFilterKindTag {
+		return fmt.Errorf("invalid kind %s", f.Kind)
+	}
+	if len(f.Pattern) == 0 {
+		return fmt.Errorf("empty pattern")
+	}
+	switch f.Type {
+	case RepFilterTypeGlob:
+		if _, err := path.Match(f.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s", f.Pattern)
+		}
+	case RepFilterTypeRegex:
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %s", f.Pattern)
+		}
+	default:
+		return fmt.Errorf("invalid type %s", f.Type)
+	}
+	return nil
+}
+
+// match returns whether the name matches the pattern of the filter
+func (f *RepFilter) match(name string) bool {
+	if f.Type == RepFilterTypeRegex {
+		matched, err := regexp.MatchString("^(?:"+f.Pattern+")$", name)
+		return err == nil && matched
+	}
+	matched, err := path.Match(f.Pattern, name)
+	return err == nil && matched
+}
+
+// selects returns whether the name is selected by the filters of the kind
+func (r *RepPolicy) selects(kind, name string) bool {
+	included, hasInclusion := false, false
+	for _, f := range r.Filters {
+		if f.Kind != kind {
+			continue
+		}
+		if f.Exclude {
+			if f.match(name) {
+				return false
+			}
+			continue
+		}
+		hasInclusion = true
+		if !included && f.match(name) {
+			included = true
+		}
+	}
+	return included || !hasInclusion
+}
+
+// MatchRepository returns whether the repository, e.g. "library/ubuntu", is selected by the
+// repository filters of the policy
+func (r *RepPolicy) MatchRepository(repository string) bool {
+	name := strings.TrimRight(strings.TrimSpace(repository), "/")
+	if i := strings.Index(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return r.selects(RepFilterKindRepository, name)
+}
+
+// FilterTags returns the tags which are selected by the tag filters of the policy
+func (r *RepPolicy) FilterTags(tags []string) []string {
+	result := []string{}
+	for _, tag := range tags {
+		if r.selects(RepFilterKindTag, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// HasTagFilter returns whether the policy has tag filters
+func (r *RepPolicy) HasTagFilter() bool {
+	for _, f := range r.Filters {
+		if f.Kind == RepFilterKindTag {
+			return true
+		}
+	}
+	return false
+}
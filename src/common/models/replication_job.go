@@ -16,10 +16,12 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/registry"
 )
 
 const (
@@ -43,6 +45,32 @@ const (
 	RepOpTransfer string = "transfer"
 	//RepOpDelete represents the operation of a job to remove repository from a remote registry/harbor instance.
 	RepOpDelete string = "delete"
+	//RepOpPull represents the operation of a job to transfer repository from a remote registry/harbor instance to local.
+	RepOpPull string = "pull"
+	//JobKindReplication represents the kind of the jobs which replicate repositories, it is the default kind of jobs.
+	JobKindReplication string = "replication"
+	//RepDirectionPush represents a policy which replicates repositories from local to the target, it is the default direction.
+	RepDirectionPush string = "push"
+	//RepDirectionPull represents a policy which replicates repositories from the target to local.
+	RepDirectionPull string = "pull"
+	//RepTargetTypeHarbor represents a target which is a harbor instance, it is the default type of targets.
+	RepTargetTypeHarbor int = 0
+	//RepTargetTypeRegistry represents a target which is a regular docker registry v2.
+	RepTargetTypeRegistry int = 1
+	//RepTriggerManual represents an execution triggered by users, e.g. by enabling a policy.
+	RepTriggerManual string = "manual"
+	//RepTriggerPush represents an execution triggered by pushing or deleting images.
+	RepTriggerPush string = "push"
+	//RepTriggerSchedule represents an execution triggered by the schedule of a policy.
+	RepTriggerSchedule string = "schedule"
+	//RepExecutionInProgress represents an execution which has jobs not completed.
+	RepExecutionInProgress string = "in_progress"
+	//RepExecutionSucceeded represents an execution whose jobs all finished.
+	RepExecutionSucceeded string = "succeeded"
+	//RepExecutionFailed represents a completed execution which has failed jobs.
+	RepExecutionFailed string = "failed"
+	//RepExecutionStopped represents a completed execution which has stopped or canceled jobs but no failed jobs.
+	RepExecutionStopped string = "stopped"
 	//UISecretCookie is the cookie name to contain the UI secret
 	UISecretCookie string = "uisecret"
 )
@@ -56,14 +84,23 @@ type RepPolicy struct {
 	TargetName  string `json:"target_name,omitempty"`
 	Name        string `orm:"column(name)" json:"name"`
 	//	Target       RepTarget `orm:"-" json:"target"`
-	Enabled       int       `orm:"column(enabled)" json:"enabled"`
-	Description   string    `orm:"column(description)" json:"description"`
-	CronStr       string    `orm:"column(cron_str)" json:"cron_str"`
-	StartTime     time.Time `orm:"column(start_time)" json:"start_time"`
-	CreationTime  time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime    time.Time `orm:"column(update_time);auto_now" json:"update_time"`
-	ErrorJobCount int       `json:"error_job_count"`
-	Deleted       int       `orm:"column(deleted)" json:"deleted"`
+	Enabled       int              `orm:"column(enabled)" json:"enabled"`
+	Description   string           `orm:"column(description)" json:"description"`
+	CronStr       string           `orm:"column(cron_str)" json:"cron_str"`
+	Direction     string           `orm:"column(direction)" json:"direction"`
+	FiltersStr    string           `orm:"column(filters)" json:"-"`
+	Filters       []*RepFilter     `orm:"-" json:"filters"`
+	WindowsStr    string           `orm:"column(time_windows)" json:"-"`
+	Windows       []*RepTimeWindow `orm:"-" json:"time_windows"`
+	StartTime     time.Time        `orm:"column(start_time)" json:"start_time"`
+	CreationTime  time.Time        `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime    time.Time        `orm:"column(update_time);auto_now" json:"update_time"`
+	ErrorJobCount int              `json:"error_job_count"`
+	Deleted       int              `orm:"column(deleted)" json:"deleted"`
+	NextRunTime   *time.Time       `orm:"-" json:"next_run_time,omitempty"`
+	// NextRun is the next run time recorded by the scheduler of job service, it is zero
+	// if the policy is not scheduled
+	NextRun time.Time `orm:"column(next_run_time)" json:"-"`
 }
 
 // Valid ...
@@ -88,36 +125,239 @@ func (r *RepPolicy) Valid(v *validation.Validation) {
 		v.SetError("enabled", "must be 0 or 1")
 	}
 
+	if len(r.Direction) == 0 {
+		r.Direction = RepDirectionPush
+	}
+
+	if r.Direction != RepDirectionPush && r.Direction != RepDirectionPull {
+		v.SetError("direction", "must be push or pull")
+	}
+
 	if len(r.CronStr) > 256 {
 		v.SetError("cron_str", "max length is 256")
 	}
+
+	if len(r.CronStr) != 0 {
+		if _, err := utils.ParseCron(r.CronStr); err != nil {
+			v.SetError("cron_str", "invalid")
+		}
+	}
+
+	for _, f := range r.Filters {
+		if err := f.validate(); err != nil {
+			v.SetError("filters", err.Error())
+			break
+		}
+	}
+
+	for _, w := range r.Windows {
+		if err := w.validate(); err != nil {
+			v.SetError("time_windows", err.Error())
+			break
+		}
+	}
 }
 
 // RepJob is the model for a replication job, which is the execution unit on job service, currently it is used to transfer/remove
-// a repository to/from a remote registry instance.
+// a repository to/from a remote registry instance. The jobs of other kinds share the job queue with it, the kind
+// of a job selects the job type which handles it.
 type RepJob struct {
 	ID         int64    `orm:"column(id)" json:"id"`
 	Status     string   `orm:"column(status)" json:"status"`
+	Kind       string   `orm:"column(kind)" json:"kind"`
 	Repository string   `orm:"column(repository)" json:"repository"`
 	PolicyID   int64    `orm:"column(policy_id)" json:"policy_id"`
 	Operation  string   `orm:"column(operation)" json:"operation"`
 	Tags       string   `orm:"column(tags)" json:"-"`
 	TagList    []string `orm:"-" json:"tags"`
+	// ExecutionID is the ID of the execution which owns the job, 0 means none
+	ExecutionID int64 `orm:"column(execution_id)" json:"execution_id"`
+	// Digest is the digest of the manifest replicated, a job which carries a digest
+	// when it is created replicates its tag at that digest. It only applies to the jobs
+	// which have exactly one tag, the jobs of several tags or of the whole repository
+	// replicate the manifests the tags point to when they run and record no digest.
+	Digest string `orm:"column(digest)" json:"digest"`
 	//	Policy       RepPolicy `orm:"-" json:"policy"`
+	RetryCount      int              `orm:"column(retry_count)" json:"retry_count"`
+	NextAttemptTime time.Time        `orm:"column(next_attempt_time)" json:"next_attempt_time"`
+	Attempts        []*RepJobAttempt `orm:"-" json:"attempts,omitempty"`
+	ProgressStr     string           `orm:"column(progress)" json:"-"`
+	Progress        *RepJobProgress  `orm:"-" json:"progress,omitempty"`
+	CreationTime    time.Time        `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime      time.Time        `orm:"column(update_time);auto_now" json:"update_time"`
+}
+
+// RepJobProgress is the progress of a replication job. The totals of blobs and bytes grow
+// as the manifest of each tag is pulled, they only cover the tags which have been handled.
+type RepJobProgress struct {
+	TagsTotal        int    `json:"tags_total"`
+	TagsDone         int    `json:"tags_done"`
+	BlobsTotal       int    `json:"blobs_total"`
+	BlobsDone        int    `json:"blobs_done"`
+	BytesTotal       int64  `json:"bytes_total"`
+	BytesTransferred int64  `json:"bytes_transferred"`
+	CurrentBlob      string `json:"current_blob,omitempty"`
+	// Uploads are the chunked uploads of the blobs being transferred keyed by digest,
+	// they are resumed when the job is retried
+	Uploads map[string]*RepBlobUpload `json:"uploads,omitempty"`
+	// Throughput is the average transfer rate in bytes per second
+	Throughput int64     `json:"throughput"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// RepBlobUpload is the chunked upload of a blob on the destination registry
+type RepBlobUpload struct {
+	// Location is the location of the upload, it can be resumed from it
+	Location string `json:"location"`
+	// Offset is the count of bytes the destination registry has received
+	Offset int64 `json:"offset"`
+}
+
+// RepJobAttempt records a failed attempt of a replication job
+type RepJobAttempt struct {
+	ID           int64     `orm:"column(id)" json:"-"`
+	JobID        int64     `orm:"column(job_id)" json:"-"`
+	Attempt      int       `orm:"column(attempt)" json:"attempt"`
+	Error        string    `orm:"column(error)" json:"error"`
 	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime   time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+}
+
+// RepBlobLocation records a repository of the target in which a blob is known to exist,
+// the blob can be mounted from it when it is replicated to other repositories of the target.
+type RepBlobLocation struct {
+	ID         int64     `orm:"column(id)" json:"-"`
+	TargetID   int64     `orm:"column(target_id)" json:"target_id"`
+	Digest     string    `orm:"column(digest)" json:"digest"`
+	Repository string    `orm:"column(repository)" json:"repository"`
+	UpdateTime time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+}
+
+// RepTargetStatus is the result of a health check of a target
+type RepTargetStatus struct {
+	ID       int64 `orm:"column(id)" json:"-"`
+	TargetID int64 `orm:"column(target_id)" json:"target_id"`
+	// Reachable is false if the target can not be connected or it returns a server error
+	Reachable bool `orm:"column(reachable)" json:"reachable"`
+	// AuthValid is false if the target rejects the credential of the target
+	AuthValid bool `orm:"column(auth_valid)" json:"auth_valid"`
+	// Latency is the time in milliseconds the target takes to respond to the ping
+	Latency   int64     `orm:"column(latency)" json:"latency"`
+	Error     string    `orm:"column(error)" json:"error,omitempty"`
+	CheckTime time.Time `orm:"column(check_time);auto_now_add" json:"check_time"`
+}
+
+// RepDiff is the difference between the tags of a repository in the source registry
+// and the ones in the destination registry of a policy
+type RepDiff struct {
+	Repository string `json:"repository"`
+	// Missing are the tags which do not exist in the destination registry
+	Missing []string `json:"missing"`
+	// Stale are the tags whose digests in the destination registry differ from the source
+	Stale []string `json:"stale"`
+	// Extra are the tags which only exist in the destination registry
+	Extra []string `json:"extra"`
+	// Shared are the tags which only exist in the destination registry but refer to the
+	// same manifests as the tags kept there, they are not deleted when the diff is applied
+	Shared []string `json:"shared"`
+	// Error is the error occurred while comparing the tags
+	Error string `json:"error,omitempty"`
+}
+
+// Empty returns whether the tags in the source and destination registries are the same
+func (d *RepDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Stale) == 0 && len(d.Extra) == 0 && len(d.Shared) == 0 &&
+		len(d.Error) == 0
+}
+
+// RepJobCount is the count of replication jobs grouped by policy, target, operation and status
+type RepJobCount struct {
+	PolicyID  int64  `orm:"column(policy_id)"`
+	TargetID  int64  `orm:"column(target_id)"`
+	Operation string `orm:"column(operation)"`
+	Status    string `orm:"column(status)"`
+	Count     int64  `orm:"column(count)"`
+}
+
+// RepExecution is a run of a policy triggered once, it owns the jobs created by the run.
+// The counts of its jobs and its end time are calculated from the jobs.
+type RepExecution struct {
+	ID        int64     `orm:"column(id)" json:"id"`
+	PolicyID  int64     `orm:"column(policy_id)" json:"policy_id"`
+	Trigger   string    `orm:"column(trigger_source)" json:"trigger"`
+	StartTime time.Time `orm:"column(start_time);auto_now_add" json:"start_time"`
+	// EndTime is the time the last job completed, it is nil if there are jobs in progress
+	EndTime    *time.Time `orm:"-" json:"end_time,omitempty"`
+	Status     string     `orm:"-" json:"status"`
+	Total      int64      `orm:"-" json:"total"`
+	Succeeded  int64      `orm:"-" json:"succeeded"`
+	Failed     int64      `orm:"-" json:"failed"`
+	Stopped    int64      `orm:"-" json:"stopped"`
+	InProgress int64      `orm:"-" json:"in_progress"`
+}
+
+// RepExecutionJobCount is the count of the jobs of an execution in a status
+type RepExecutionJobCount struct {
+	ExecutionID int64  `orm:"column(execution_id)"`
+	Status      string `orm:"column(status)"`
+	Count       int64  `orm:"column(count)"`
+}
+
+// AddJobCount adds the count of its jobs in the status to the execution, and
+// updates the status of the execution
+func (e *RepExecution) AddJobCount(status string, count int64) {
+	e.Total += count
+	switch status {
+	case JobFinished:
+		e.Succeeded += count
+	case JobError:
+		e.Failed += count
+	case JobStopped, JobCanceled:
+		e.Stopped += count
+	default:
+		e.InProgress += count
+	}
+
+	switch {
+	case e.InProgress > 0:
+		e.Status = RepExecutionInProgress
+	case e.Failed > 0:
+		e.Status = RepExecutionFailed
+	case e.Stopped > 0:
+		e.Status = RepExecutionStopped
+	default:
+		e.Status = RepExecutionSucceeded
+	}
 }
 
 // RepTarget is the model for a replication targe, i.e. destination, which wraps the endpoint URL and username/password of a remote registry.
 type RepTarget struct {
-	ID           int64     `orm:"column(id)" json:"id"`
-	URL          string    `orm:"column(url)" json:"endpoint"`
-	Name         string    `orm:"column(name)" json:"name"`
-	Username     string    `orm:"column(username)" json:"username"`
-	Password     string    `orm:"column(password)" json:"password"`
-	Type         int       `orm:"column(target_type)" json:"type"`
-	CreationTime time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
-	UpdateTime   time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	ID       int64  `orm:"column(id)" json:"id"`
+	URL      string `orm:"column(url)" json:"endpoint"`
+	Name     string `orm:"column(name)" json:"name"`
+	Username string `orm:"column(username)" json:"username"`
+	Password string `orm:"column(password)" json:"password"`
+	Type     int    `orm:"column(target_type)" json:"type"`
+	// BandwidthLimit is the max rate in KB per second of the blobs transferred
+	// with the target by all the jobs, 0 means no limit
+	BandwidthLimit int64 `orm:"column(bandwidth_limit)" json:"bandwidth_limit"`
+	// Insecure skips the verification of the certificate of the target
+	Insecure bool `orm:"column(insecure)" json:"insecure"`
+	// CACert is the PEM encoded CA bundle to verify the certificate of the target
+	CACert string `orm:"column(ca_cert)" json:"ca_cert"`
+	// ClientCert and ClientKey are the PEM encoded certificate and key presented
+	// to the target for mutual TLS
+	ClientCert string `orm:"column(client_cert)" json:"client_cert"`
+	ClientKey  string `orm:"column(client_key)" json:"client_key"`
+	// ProxyURL is the URL of the HTTP(S) proxy through which the target is connected,
+	// the hosts in NoProxy are connected directly
+	ProxyURL      string    `orm:"column(proxy_url)" json:"proxy_url"`
+	ProxyUsername string    `orm:"column(proxy_username)" json:"proxy_username"`
+	ProxyPassword string    `orm:"column(proxy_password)" json:"proxy_password"`
+	NoProxy       string    `orm:"column(no_proxy)" json:"no_proxy"`
+	CreationTime  time.Time `orm:"column(creation_time);auto_now_add" json:"creation_time"`
+	UpdateTime    time.Time `orm:"column(update_time);auto_now" json:"update_time"`
+	// Status is the result of the latest health check of the target
+	Status *RepTargetStatus `orm:"-" json:"status,omitempty"`
 }
 
 // Valid ...
@@ -134,6 +374,14 @@ func (r *RepTarget) Valid(v *validation.Validation) {
 		v.SetError("endpoint", "can not be empty")
 	}
 
+	if r.Type != RepTargetTypeHarbor && r.Type != RepTargetTypeRegistry {
+		v.SetError("type", fmt.Sprintf("invalid type %d", r.Type))
+	}
+
+	if r.BandwidthLimit < 0 {
+		v.SetError("bandwidth_limit", "can not be negative")
+	}
+
 	r.URL = utils.FormatEndpoint(r.URL)
 
 	if len(r.URL) > 64 {
@@ -145,6 +393,36 @@ func (r *RepTarget) Valid(v *validation.Validation) {
 	if len(r.Password) > 48 {
 		v.SetError("password", "max length is 48")
 	}
+
+	if err := (&registry.TransportConfig{CACert: r.CACert}).Validate(); err != nil {
+		v.SetError("ca_cert", err.Error())
+	}
+
+	if err := (&registry.TransportConfig{ClientCert: r.ClientCert, ClientKey: r.ClientKey}).Validate(); err != nil {
+		v.SetError("client_cert", err.Error())
+	}
+
+	if len(r.ProxyURL) > 256 {
+		v.SetError("proxy_url", "max length is 256")
+	}
+
+	if len(r.ProxyUsername) > 40 {
+		v.SetError("proxy_username", "max length is 40")
+	}
+
+	// proxy password is encrypted as password
+	if len(r.ProxyPassword) > 48 {
+		v.SetError("proxy_password", "max length is 48")
+	}
+
+	if len(r.NoProxy) > 512 {
+		v.SetError("no_proxy", "max length is 512")
+	}
+
+	if err := (&registry.TransportConfig{ProxyURL: r.ProxyURL, ProxyUsername: r.ProxyUsername,
+		ProxyPassword: r.ProxyPassword, NoProxy: r.NoProxy}).Validate(); err != nil {
+		v.SetError("proxy_url", err.Error())
+	}
 }
 
 //TableName is required by by beego orm to map RepTarget to table replication_target
@@ -157,6 +435,26 @@ func (r *RepJob) TableName() string {
 	return "replication_job"
 }
 
+//TableName is required by by beego orm to map RepExecution to table replication_execution
+func (r *RepExecution) TableName() string {
+	return "replication_execution"
+}
+
+//TableName is required by by beego orm to map RepJobAttempt to table replication_job_attempt
+func (r *RepJobAttempt) TableName() string {
+	return "replication_job_attempt"
+}
+
+//TableName is required by by beego orm to map RepBlobLocation to table replication_blob_location
+func (r *RepBlobLocation) TableName() string {
+	return "replication_blob_location"
+}
+
+//TableName is required by by beego orm to map RepTargetStatus to table replication_target_status
+func (r *RepTargetStatus) TableName() string {
+	return "replication_target_status"
+}
+
 //TableName is required by by beego orm to map RepPolicy to table replication_policy
 func (r *RepPolicy) TableName() string {
 	return "replication_policy"
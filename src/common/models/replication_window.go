@@ -0,0 +1,112 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// RepTimeWindow is a daily time window during which the jobs of a policy may start, the
+// times are in the form of "15:04" in the time zone of job service. The window crosses
+// midnight if the end is earlier than the start, and it belongs to the day it starts on.
+// The window opens every day if no weekday is set.
+type RepTimeWindow struct {
+	Start    string         `json:"start"`
+	End      string         `json:"end"`
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+}
+
+// parseClock returns the minutes of the time since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validate checks the start, end and weekdays of the window
+func (w *RepTimeWindow) validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("start and end of time window are the same")
+	}
+	for _, d := range w.Weekdays {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", d)
+		}
+	}
+	return nil
+}
+
+// contains returns whether the window is open at t
+func (w *RepTimeWindow) contains(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start < end:
+		if now < start || now >= end {
+			return false
+		}
+	case now >= start:
+	case now < end:
+		// the window opened the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindow returns whether the jobs of the policy may start at t, which is true if
+// one of the time windows of the policy is open or the policy has no time window.
+func (r *RepPolicy) InWindow(t time.Time) bool {
+	if len(r.Windows) == 0 {
+		return true
+	}
+	for _, w := range r.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
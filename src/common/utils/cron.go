@@ -0,0 +1,72 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/toolbox"
+)
+
+// ParseCron parses the cron string, both the standard format with 5 fields
+// (minute hour day-of-month month day-of-week) and the format with an extra
+// leading field for second are supported, as well as the descriptors such as
+// "@daily" and "@hourly".
+func ParseCron(cron string) (schedule *toolbox.Schedule, err error) {
+	cron = strings.TrimSpace(cron)
+	if len(cron) == 0 {
+		return nil, fmt.Errorf("empty cron string")
+	}
+
+	if len(strings.Fields(cron)) == 5 {
+		cron = "0 " + cron
+	}
+
+	// toolbox panics when the cron string is invalid
+	defer func() {
+		if r := recover(); r != nil {
+			schedule = nil
+			err = fmt.Errorf("invalid cron string %s: %v", cron, r)
+		}
+	}()
+
+	task := &toolbox.Task{}
+	task.SetCron(cron)
+	return task.Spec, nil
+}
+
+// NextRunTime returns the next time after now when the cron string fires,
+// the time will not be earlier than startTime if it is not zero.
+func NextRunTime(cron string, startTime, now time.Time) (time.Time, error) {
+	schedule, err := ParseCron(cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !startTime.IsZero() && now.Before(startTime) {
+		// Next returns the time after the parameter at least one second
+		now = startTime.Add(-time.Second)
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return next, fmt.Errorf("cron string %s will not fire in the next five years", cron)
+	}
+
+	return next, nil
+}
@@ -42,10 +42,16 @@ type AuthorizerStore struct {
 
 // NewAuthorizerStore ...
 func NewAuthorizerStore(endpoint string, insecure bool, authorizers ...Authorizer) (*AuthorizerStore, error) {
+	return NewAuthorizerStoreWithTransport(endpoint, registry.GetHTTPTransport(insecure), authorizers...)
+}
+
+// NewAuthorizerStoreWithTransport returns an AuthorizerStore which pings the
+// registry through the transport
+func NewAuthorizerStoreWithTransport(endpoint string, transport http.RoundTripper, authorizers ...Authorizer) (*AuthorizerStore, error) {
 	endpoint = utils.FormatEndpoint(endpoint)
 
 	client := &http.Client{
-		Transport: registry.GetHTTPTransport(insecure),
+		Transport: transport,
 		Timeout:   30 * time.Second,
 	}
 
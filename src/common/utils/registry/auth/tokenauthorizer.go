@@ -140,9 +140,17 @@ type standardTokenAuthorizer struct {
 // NewStandardTokenAuthorizer returns a standard token authorizer. The authorizer will request a token
 // from token server and add it to the origin request
 func NewStandardTokenAuthorizer(credential Credential, insecure bool, scopeType, scopeName string, scopeActions ...string) Authorizer {
+	return NewStandardTokenAuthorizerWithTransport(credential, registry.GetHTTPTransport(insecure),
+		scopeType, scopeName, scopeActions...)
+}
+
+// NewStandardTokenAuthorizerWithTransport returns a standard token authorizer which
+// requests the token through the transport
+func NewStandardTokenAuthorizerWithTransport(credential Credential, transport http.RoundTripper,
+	scopeType, scopeName string, scopeActions ...string) Authorizer {
 	authorizer := &standardTokenAuthorizer{
 		client: &http.Client{
-			Transport: registry.GetHTTPTransport(insecure),
+			Transport: transport,
 			Timeout:   30 * time.Second,
 		},
 		credential: credential,
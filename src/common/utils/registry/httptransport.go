@@ -0,0 +1,234 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportConfig holds the TLS and proxy settings used to connect to a registry,
+// the certificates and the key are PEM encoded
+type TransportConfig struct {
+	Insecure bool
+	// CACert is the bundle of CA certificates trusted in addition to the system ones
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	// ProxyURL is the URL of the HTTP(S) proxy the requests are sent through,
+	// empty means connecting to the registry directly
+	ProxyURL      string
+	ProxyUsername string
+	ProxyPassword string
+	// NoProxy is a comma separated list of hosts, domains and CIDRs which are
+	// connected directly
+	NoProxy string
+	// TargetID and UpdateTime identify the version of the settings of a target, the
+	// transport built from them is cached for the target and Insecure until the target
+	// is updated. The transport is not cached if TargetID is 0.
+	TargetID   int64
+	UpdateTime time.Time
+}
+
+// Validate checks whether the CA bundle, the client certificate and the proxy
+// URL can be loaded
+func (c *TransportConfig) Validate() error {
+	if _, err := c.tlsConfig(); err != nil {
+		return err
+	}
+	_, err := c.proxy()
+	return err
+}
+
+func (c *TransportConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+	}
+
+	if len(c.CACert) != 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("no valid certificate found in CA bundle")
+		}
+		config.RootCAs = pool
+	}
+
+	if len(c.ClientCert) != 0 || len(c.ClientKey) != 0 {
+		if len(c.ClientCert) == 0 || len(c.ClientKey) == 0 {
+			return nil, errors.New("client certificate and key must be provided together")
+		}
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// proxy returns the function which selects the proxy of a request, nil means
+// no proxy is used
+func (c *TransportConfig) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if len(c.ProxyURL) == 0 {
+		if len(c.ProxyUsername) != 0 || len(c.ProxyPassword) != 0 || len(c.NoProxy) != 0 {
+			return nil, errors.New("proxy URL is needed")
+		}
+		return nil, nil
+	}
+
+	u, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy URL %s, only http and https proxies are supported", c.ProxyURL)
+	}
+	if len(c.ProxyUsername) != 0 {
+		u.User = url.UserPassword(c.ProxyUsername, c.ProxyPassword)
+	}
+
+	noProxy := []string{}
+	for _, host := range strings.Split(c.NoProxy, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); len(host) != 0 {
+			noProxy = append(noProxy, host)
+		}
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+// bypassProxy returns whether the host matches any entry of noProxy, an entry
+// can be "*", a host, a domain which matches its subdomains, or a CIDR
+func bypassProxy(host string, noProxy []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// the interval after which the idle connections of the transports are closed
+const idleConnTimeout = 90 * time.Second
+
+// transportKey identifies the cached transport of a target, the verification of the
+// certificate may be skipped or not for the same settings of a target
+type transportKey struct {
+	targetID int64
+	insecure bool
+}
+
+// cachedTransport is the transport built from the settings of a target at UpdateTime
+type cachedTransport struct {
+	updateTime time.Time
+	transport  *http.Transport
+}
+
+var (
+	transports    = map[transportKey]*cachedTransport{}
+	transportLock sync.Mutex
+)
+
+// GetTransport returns the HttpTransport built from the settings, the transport of a
+// target is cached so that the connections to the target are reused, and it is replaced
+// once the settings of the target are updated.
+func GetTransport(c *TransportConfig) (*http.Transport, error) {
+	if c == nil {
+		return GetHTTPTransport(false), nil
+	}
+	if len(c.CACert) == 0 && len(c.ClientCert) == 0 && len(c.ClientKey) == 0 &&
+		len(c.ProxyURL) == 0 {
+		return GetHTTPTransport(c.Insecure), nil
+	}
+	if c.TargetID == 0 {
+		return c.transport()
+	}
+
+	transportLock.Lock()
+	defer transportLock.Unlock()
+
+	key := transportKey{
+		targetID: c.TargetID,
+		insecure: c.Insecure,
+	}
+	cached, ok := transports[key]
+	if ok && cached.updateTime.Equal(c.UpdateTime) {
+		return cached.transport, nil
+	}
+
+	transport, err := c.transport()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cached.transport.CloseIdleConnections()
+	}
+	transports[key] = &cachedTransport{
+		updateTime: c.UpdateTime,
+		transport:  transport,
+	}
+	return transport, nil
+}
+
+func (c *TransportConfig) transport() (*http.Transport, error) {
+	config, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := c.proxy()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{
+		TLSClientConfig: config,
+		Proxy:           proxy,
+		IdleConnTimeout: idleConnTimeout,
+	}, nil
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ca := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.TLS.Certificates[0].Certificate[0],
+	}))
+
+	updated := time.Now()
+	transport, err := GetTransport(&TransportConfig{CACert: ca, TargetID: 1, UpdateTime: updated})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to request the server trusted by the CA bundle: %v", err)
+	}
+	resp.Body.Close()
+
+	transport2, err := GetTransport(&TransportConfig{CACert: ca, TargetID: 1, UpdateTime: updated})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if transport2 != transport {
+		t.Errorf("the transport of the same target should be reused")
+	}
+
+	transport2, err = GetTransport(&TransportConfig{CACert: ca, TargetID: 1, UpdateTime: updated.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if transport2 == transport {
+		t.Errorf("the transport of the target should be replaced once the target is updated")
+	}
+	if len(transports) != 1 {
+		t.Errorf("unexpected count of cached transports: %d != 1", len(transports))
+	}
+
+	insecure, err := GetTransport(&TransportConfig{Insecure: true, CACert: ca, TargetID: 1,
+		UpdateTime: updated.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if insecure == transport2 || !insecure.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("the transport which skips the verification of the certificate should not be shared")
+	}
+	if len(transports) != 2 {
+		t.Errorf("unexpected count of cached transports: %d != 2", len(transports))
+	}
+
+	transport2, err = GetTransport(&TransportConfig{CACert: ca})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if transport2 == transport || len(transports) != 2 {
+		t.Errorf("the transport of the settings not of a target should not be cached")
+	}
+
+	transport, err = GetTransport(&TransportConfig{})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	if _, err = (&http.Client{Transport: transport}).Get(server.URL); err == nil {
+		t.Errorf("expected error for the server not trusted")
+	}
+
+	invalid := []*TransportConfig{
+		&TransportConfig{CACert: "invalid"},
+		&TransportConfig{ClientCert: ca},
+		&TransportConfig{ClientCert: ca, ClientKey: "invalid"},
+		&TransportConfig{ProxyURL: "ftp://proxy:21"},
+		&TransportConfig{NoProxy: "localhost"},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for invalid TLS settings %+v", c)
+		}
+	}
+}
+
+func TestGetTransportWithProxy(t *testing.T) {
+	var host, auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		auth = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	transport, err := GetTransport(&TransportConfig{
+		ProxyURL:      proxy.URL,
+		ProxyUsername: "user",
+		ProxyPassword: "password",
+		NoProxy:       "localhost",
+	})
+	if err != nil {
+		t.Fatalf("failed to get transport: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get("http://registry.example.com/v2/")
+	if err != nil {
+		t.Fatalf("failed to request through the proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	if host != "registry.example.com" {
+		t.Errorf("unexpected host: %s != %s", host, "registry.example.com")
+	}
+	if len(auth) == 0 {
+		t.Errorf("the credential of the proxy is not sent")
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"localhost", ".example.com", "registry.org:443", "10.0.0.0/8"}
+	cases := map[string]bool{
+		"localhost:5000":     true,
+		"example.com":        true,
+		"hub.example.com":    true,
+		"registry.org":       true,
+		"myregistry.org":     false,
+		"10.1.2.3:443":       true,
+		"192.168.0.1":        false,
+		"registry.docker.io": false,
+	}
+	for host, expected := range cases {
+		if bypass := bypassProxy(host, noProxy); bypass != expected {
+			t.Errorf("unexpected result for %s: %v != %v", host, bypass, expected)
+		}
+	}
+
+	if !bypassProxy("registry.docker.io", []string{"*"}) {
+		t.Errorf("all hosts should bypass the proxy with *")
+	}
+}
@@ -54,3 +54,64 @@ func TestUnMarshal(t *testing.T) {
 		t.Errorf("unexpected digest: %s != %s", refs[0].Digest.String(), digest)
 	}
 }
+
+func TestUnMarshalManifestList(t *testing.T) {
+	b := []byte(`{
+   "schemaVersion":2,
+   "mediaType":"application/vnd.docker.distribution.manifest.list.v2+json",
+   "manifests":[
+      {
+         "mediaType":"application/vnd.docker.distribution.manifest.v2+json",
+         "size":524,
+         "digest":"sha256:9f9e5b5a2e7d4c6a6b2b3e0b8e1f7c6d5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d",
+         "platform":{
+            "architecture":"amd64",
+            "os":"linux"
+         }
+      },
+      {
+         "mediaType":"application/vnd.docker.distribution.manifest.v2+json",
+         "size":525,
+         "digest":"sha256:0d1c2b3a4f5e6d7c8b9a0f1e2d3c4b5a6d5c6e1f8b0e3b2b6a6c4d7e2a5b5e9f",
+         "platform":{
+            "architecture":"arm",
+            "os":"linux",
+            "variant":"v7"
+         }
+      }
+   ]
+}`)
+
+	manifest, descriptor, err := UnMarshal(MediaTypeManifestList, b)
+	if err != nil {
+		t.Fatalf("failed to parse manifest list: %v", err)
+	}
+
+	list, ok := manifest.(*ManifestList)
+	if !ok {
+		t.Fatalf("unexpected type of manifest: %T", manifest)
+	}
+
+	if len(list.Manifests) != 2 || list.Manifests[1].Platform.Architecture != "arm" ||
+		list.Manifests[1].Platform.Variant != "v7" {
+		t.Errorf("unexpected manifests: %+v", list.Manifests)
+	}
+
+	refs := list.References()
+	digest := "sha256:9f9e5b5a2e7d4c6a6b2b3e0b8e1f7c6d5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d"
+	if len(refs) != 2 || refs[0].Digest.String() != digest {
+		t.Errorf("unexpected references: %+v", refs)
+	}
+
+	// the payload must be the same as the one pulled, or the digest changes
+	mediaType, payload, err := list.Payload()
+	if err != nil {
+		t.Fatalf("failed to get payload of manifest list: %v", err)
+	}
+	if mediaType != MediaTypeManifestList || string(payload) != string(b) {
+		t.Errorf("unexpected payload of manifest list: %s, %s", mediaType, string(payload))
+	}
+	if descriptor.Size != int64(len(b)) {
+		t.Errorf("unexpected size of manifest list: %d != %d", descriptor.Size, len(b))
+	}
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/distribution"
+	dgst "github.com/docker/distribution/digest"
+	distmanifest "github.com/docker/distribution/manifest"
+)
+
+// MediaTypeManifestList is the media type of manifest list, which references the
+// manifests of an image built for different platforms
+const MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+func init() {
+	err := distribution.RegisterManifestSchema(MediaTypeManifestList,
+		func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+			m := &ManifestList{}
+			if err := m.UnmarshalJSON(b); err != nil {
+				return nil, distribution.Descriptor{}, err
+			}
+			return m, distribution.Descriptor{
+				Digest:    dgst.FromBytes(b),
+				Size:      int64(len(b)),
+				MediaType: MediaTypeManifestList,
+			}, nil
+		})
+	if err != nil {
+		panic(fmt.Sprintf("failed to register manifest list: %v", err))
+	}
+}
+
+// Platform describes the platform which the image in a manifest runs on
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	Features     []string `json:"features,omitempty"`
+}
+
+// ManifestDescriptor references the manifest for a platform
+type ManifestDescriptor struct {
+	distribution.Descriptor
+	Platform Platform `json:"platform"`
+}
+
+// ManifestList references the manifests of an image built for different platforms
+type ManifestList struct {
+	distmanifest.Versioned
+	Manifests []ManifestDescriptor `json:"manifests"`
+
+	// canonical is the payload the manifest list is unmarshaled from, it is kept
+	// as the digest of the manifest list is calculated from it
+	canonical []byte
+}
+
+// References returns the descriptors of the platform manifests
+func (m *ManifestList) References() []distribution.Descriptor {
+	references := make([]distribution.Descriptor, 0, len(m.Manifests))
+	for _, descriptor := range m.Manifests {
+		references = append(references, descriptor.Descriptor)
+	}
+	return references
+}
+
+// Payload returns the media type and the canonical payload of the manifest list
+func (m *ManifestList) Payload() (string, []byte, error) {
+	return MediaTypeManifestList, m.canonical, nil
+}
+
+// UnmarshalJSON populates the manifest list from its payload
+func (m *ManifestList) UnmarshalJSON(b []byte) error {
+	// the alias type makes json.Unmarshal not call UnmarshalJSON recursively
+	type manifestList ManifestList
+	list := manifestList{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	if list.MediaType != MediaTypeManifestList {
+		return fmt.Errorf("unexpected media type of manifest list: %s", list.MediaType)
+	}
+
+	*m = ManifestList(list)
+	m.canonical = make([]byte, len(b))
+	copy(m.canonical, b)
+	return nil
+}
+
+// MarshalJSON returns the canonical payload of the manifest list
+func (m *ManifestList) MarshalJSON() ([]byte, error) {
+	if len(m.canonical) > 0 {
+		return m.canonical, nil
+	}
+	type manifestList ManifestList
+	return json.Marshal((*manifestList)(m))
+}
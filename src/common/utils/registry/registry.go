@@ -72,11 +72,14 @@ func NewRegistry(endpoint string, client *http.Client) (*Registry, error) {
 
 // NewRegistryWithModifiers returns an instance of Registry according to the modifiers
 func NewRegistryWithModifiers(endpoint string, insecure bool, modifiers ...Modifier) (*Registry, error) {
+	return NewRegistryWithTransport(endpoint, GetHTTPTransport(insecure), modifiers...)
+}
 
-	transport := NewTransport(GetHTTPTransport(insecure), modifiers...)
-
+// NewRegistryWithTransport returns an instance of Registry which sends the requests
+// through the transport after they are modified by the modifiers
+func NewRegistryWithTransport(endpoint string, transport http.RoundTripper, modifiers ...Modifier) (*Registry, error) {
 	return NewRegistry(endpoint, &http.Client{
-		Transport: transport,
+		Transport: NewTransport(transport, modifiers...),
 		Timeout:   30 * time.Second,
 	})
 }
@@ -61,10 +61,14 @@ func NewRepository(name, endpoint string, client *http.Client) (*Repository, err
 
 // NewRepositoryWithModifiers returns an instance of Repository according to the modifiers
 func NewRepositoryWithModifiers(name, endpoint string, insecure bool, modifiers ...Modifier) (*Repository, error) {
+	return NewRepositoryWithTransport(name, endpoint, GetHTTPTransport(insecure), modifiers...)
+}
 
-	transport := NewTransport(GetHTTPTransport(insecure), modifiers...)
+// NewRepositoryWithTransport returns an instance of Repository which sends the requests
+// through the transport after they are modified by the modifiers
+func NewRepositoryWithTransport(name, endpoint string, transport http.RoundTripper, modifiers ...Modifier) (*Repository, error) {
 	return NewRepository(name, endpoint, &http.Client{
-		Transport: transport,
+		Transport: NewTransport(transport, modifiers...),
 		//  for transferring large image, OS will handle i/o timeout
 		//	Timeout:   30 * time.Second,
 	})
@@ -128,6 +132,7 @@ func (r *Repository) ManifestExist(reference string) (digest string, exist bool,
 
 	req.Header.Add(http.CanonicalHeaderKey("Accept"), schema1.MediaTypeManifest)
 	req.Header.Add(http.CanonicalHeaderKey("Accept"), schema2.MediaTypeManifest)
+	req.Header.Add(http.CanonicalHeaderKey("Accept"), MediaTypeManifestList)
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -416,6 +421,205 @@ func (r *Repository) PushBlob(digest string, size int64, data io.Reader) error {
 	return r.monolithicBlobUpload(location, digest, size, data)
 }
 
+// MountBlob mounts the blob from repository from, which is on the same registry, to the
+// repository. It returns false if the registry does not mount the blob, in which case the
+// upload the registry initiates instead is cancelled and the blob needs to be pushed.
+func (r *Repository) MountBlob(digest, from string) (bool, error) {
+	req, err := http.NewRequest("POST", buildMountBlobURL(r.Endpoint.String(), r.Name, digest, from), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Length"), "0")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		r.cancelBlobUpload(resp.Header.Get(http.CanonicalHeaderKey("Location")))
+		return false, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	return false, &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+// cancelBlobUpload cancels the upload, the error is ignored as the registry
+// will purge the upload anyway.
+func (r *Repository) cancelBlobUpload(location string) {
+	if len(location) == 0 {
+		return
+	}
+	req, err := http.NewRequest("DELETE", location, nil)
+	if err != nil {
+		return
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// ResumeBlobUpload returns the location of the upload and the offset the registry has
+// received for it, the location is empty if the upload is unknown to the registry so a
+// new upload needs to be initiated.
+func (r *Repository) ResumeBlobUpload(location string) (string, int64, error) {
+	loc, offset, err := r.BlobUploadStatus(location)
+	if err != nil {
+		if regErr, ok := err.(*registry_error.Error); ok && regErr.StatusCode == http.StatusNotFound {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	return loc, offset, nil
+}
+
+// PushBlobChunked pushs the blob in chunks of chunkSize bytes. If location is not empty, the
+// upload resumes from the offset, which is returned by ResumeBlobUpload, and data holds the
+// bytes of the blob after the offset. Otherwise a new upload is initiated and data holds the
+// whole blob. uploaded is called with the location and offset after each chunk is accepted,
+// so the caller can resume the upload from the location if it fails.
+func (r *Repository) PushBlobChunked(digest string, size int64, data io.Reader, chunkSize int64,
+	location string, offset int64, uploaded func(location string, offset int64)) error {
+	if len(location) == 0 {
+		loc, _, err := r.initiateBlobUpload(r.Name)
+		if err != nil {
+			return err
+		}
+		location, offset = loc, 0
+	}
+
+	if size > 0 && size < chunkSize {
+		chunkSize = size
+	}
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(data, chunk)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return err
+			}
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		location, offset, err = r.pushBlobChunk(location, offset, chunk[:n])
+		if err != nil {
+			return err
+		}
+		if uploaded != nil {
+			uploaded(location, offset)
+		}
+	}
+
+	return r.monolithicBlobUpload(location, digest, 0, nil)
+}
+
+// BlobUploadStatus returns the location of the upload and the offset, i.e. the count
+// of bytes the registry has received for it
+func (r *Repository) BlobUploadStatus(location string) (string, int64, error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", 0, parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return r.parseUploadResponse(resp, location)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return "", 0, &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+func (r *Repository) pushBlobChunk(location string, offset int64, chunk []byte) (string, int64, error) {
+	req, err := http.NewRequest("PATCH", location, bytes.NewReader(chunk))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/octet-stream")
+	req.Header.Set(http.CanonicalHeaderKey("Content-Range"),
+		fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", 0, parseError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		return r.parseUploadResponse(resp, location)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return "", 0, &registry_error.Error{
+		StatusCode: resp.StatusCode,
+		Detail:     string(b),
+	}
+}
+
+// parseUploadResponse gets the location and offset of upload from the headers
+// "Location" and "Range" of the response, the range is in format "0-<last byte>".
+// The registry returns "0-0" for an empty upload, it is treated as offset 0 as
+// chunks are never as small as one byte.
+func (r *Repository) parseUploadResponse(resp *http.Response, location string) (string, int64, error) {
+	if loc := resp.Header.Get(http.CanonicalHeaderKey("Location")); len(loc) != 0 {
+		u, err := r.Endpoint.Parse(loc)
+		if err != nil {
+			return "", 0, err
+		}
+		location = u.String()
+	}
+
+	rng := resp.Header.Get(http.CanonicalHeaderKey("Range"))
+	if len(rng) == 0 {
+		return location, 0, nil
+	}
+	i := strings.LastIndex(rng, "-")
+	last, err := strconv.ParseInt(rng[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid range %s: %v", rng, err)
+	}
+	if last == 0 {
+		return location, 0, nil
+	}
+	return location, last + 1, nil
+}
+
 // DeleteBlob ...
 func (r *Repository) DeleteBlob(digest string) error {
 	req, err := http.NewRequest("DELETE", buildBlobURL(r.Endpoint.String(), r.Name, digest), nil)
@@ -465,6 +669,10 @@ func buildInitiateBlobUploadURL(endpoint, repoName string) string {
 	return fmt.Sprintf("%s/v2/%s/blobs/uploads/", endpoint, repoName)
 }
 
+func buildMountBlobURL(endpoint, repoName, digest, from string) string {
+	return fmt.Sprintf("%s?mount=%s&from=%s", buildInitiateBlobUploadURL(endpoint, repoName), digest, from)
+}
+
 func buildMonolithicBlobUploadURL(location, digest string) string {
 	query := ""
 	if strings.ContainsRune(location, '?') {
@@ -408,3 +408,141 @@ func TestParseError(t *testing.T) {
 func newRepository(endpoint string) (*Repository, error) {
 	return NewRepository(repository, endpoint, &http.Client{})
 }
+
+func TestPushBlobChunked(t *testing.T) {
+	received := []byte{}
+	completed := false
+	location := ""
+	uploadHandler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Header().Add(http.CanonicalHeaderKey("Location"), location)
+			w.Header().Add(http.CanonicalHeaderKey("Range"), "0-0")
+			w.WriteHeader(http.StatusAccepted)
+		case "GET":
+			w.Header().Add(http.CanonicalHeaderKey("Location"), location)
+			w.Header().Add(http.CanonicalHeaderKey("Range"), fmt.Sprintf("0-%d", len(received)-1))
+			w.WriteHeader(http.StatusNoContent)
+		case "PATCH":
+			expected := fmt.Sprintf("%d-", len(received))
+			if !strings.HasPrefix(r.Header.Get("Content-Range"), expected) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			received = append(received, b...)
+			w.Header().Add(http.CanonicalHeaderKey("Location"), location)
+			w.Header().Add(http.CanonicalHeaderKey("Range"), fmt.Sprintf("0-%d", len(received)-1))
+			w.WriteHeader(http.StatusAccepted)
+		case "PUT":
+			completed = r.URL.Query().Get("digest") == digest
+			w.WriteHeader(http.StatusCreated)
+		}
+	}
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/", repository),
+			Handler: uploadHandler,
+		})
+	defer server.Close()
+	location = fmt.Sprintf("%s/v2/%s/blobs/uploads/%s", server.URL, repository, uuid)
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	data := []byte("chunked blob")
+	chunks := 0
+	uploaded := func(loc string, offset int64) {
+		chunks++
+	}
+	if err = client.PushBlobChunked(digest, int64(len(data)), bytes.NewReader(data), 5, "", 0, uploaded); err != nil {
+		t.Fatalf("failed to push blob: %v", err)
+	}
+	if string(received) != string(data) || !completed || chunks != 3 {
+		t.Errorf("unexpected result, received: %s, completed: %v, chunks: %d", received, completed, chunks)
+	}
+
+	// resume the upload after the first 5 bytes were received
+	received = append([]byte{}, data[:5]...)
+	completed = false
+	loc, offset, err := client.ResumeBlobUpload(location)
+	if err != nil {
+		t.Fatalf("failed to get the status of upload: %v", err)
+	}
+	if loc != location || offset != 5 {
+		t.Fatalf("unexpected status of upload, location: %s, offset: %d", loc, offset)
+	}
+	if err = client.PushBlobChunked(digest, int64(len(data)), bytes.NewReader(data[offset:]), 5, loc, offset, nil); err != nil {
+		t.Fatalf("failed to resume pushing blob: %v", err)
+	}
+	if string(received) != string(data) || !completed {
+		t.Errorf("unexpected result, received: %s, completed: %v", received, completed)
+	}
+}
+
+func TestMountBlob(t *testing.T) {
+	location := ""
+	cancelled := false
+	mountHandler := func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("mount") != digest {
+			t.Errorf("unexpected mount: %s", q.Get("mount"))
+		}
+		w.Header().Add(http.CanonicalHeaderKey("Content-Length"), "0")
+		if q.Get("from") == "library/busybox" {
+			w.Header().Add(http.CanonicalHeaderKey("Location"),
+				fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Add(http.CanonicalHeaderKey("Location"), location)
+		w.Header().Add(http.CanonicalHeaderKey("Docker-Upload-UUID"), uuid)
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	cancelHandler := func(w http.ResponseWriter, r *http.Request) {
+		cancelled = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	server := test.NewServer(
+		&test.RequestHandlerMapping{
+			Method:  "POST",
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/", repository),
+			Handler: mountHandler,
+		},
+		&test.RequestHandlerMapping{
+			Method:  "DELETE",
+			Pattern: fmt.Sprintf("/v2/%s/blobs/uploads/%s", repository, uuid),
+			Handler: cancelHandler,
+		})
+	defer server.Close()
+	location = fmt.Sprintf("%s/v2/%s/blobs/uploads/%s", server.URL, repository, uuid)
+
+	client, err := newRepository(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client for repository: %v", err)
+	}
+
+	mounted, err := client.MountBlob(digest, "library/busybox")
+	if err != nil {
+		t.Fatalf("failed to mount blob: %v", err)
+	}
+	if !mounted {
+		t.Errorf("blob should be mounted from library/busybox")
+	}
+
+	mounted, err = client.MountBlob(digest, "library/alpine")
+	if err != nil {
+		t.Fatalf("failed to mount blob: %v", err)
+	}
+	if mounted {
+		t.Errorf("blob should not be mounted from library/alpine")
+	}
+	if !cancelled {
+		t.Errorf("the upload initiated instead of mounting should be cancelled")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/base64"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseEndpoint(t *testing.T) {
@@ -178,3 +179,41 @@ func TestParseLink(t *testing.T) {
 		t.Errorf("unexpected prev: %s != %s", links.Next(), next)
 	}
 }
+
+func TestParseCron(t *testing.T) {
+	valid := []string{"0 2 * * *", "0 0 2 * * *", "*/5 * * * *", "@daily"}
+	for _, cron := range valid {
+		if _, err := ParseCron(cron); err != nil {
+			t.Errorf("failed to parse cron string %s: %v", cron, err)
+		}
+	}
+
+	invalid := []string{"", "* *", "61 * * * *", "@sometimes"}
+	for _, cron := range invalid {
+		if _, err := ParseCron(cron); err == nil {
+			t.Errorf("an error is expected when parsing cron string %s", cron)
+		}
+	}
+}
+
+func TestNextRunTime(t *testing.T) {
+	now := time.Date(2016, 12, 1, 10, 30, 0, 0, time.UTC)
+
+	next, err := NextRunTime("0 2 * * *", time.Time{}, now)
+	if err != nil {
+		t.Fatalf("failed to get next run time: %v", err)
+	}
+	expected := time.Date(2016, 12, 2, 2, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) {
+		t.Errorf("unexpected next run time: %v != %v", next, expected)
+	}
+
+	startTime := time.Date(2016, 12, 10, 2, 0, 0, 0, time.UTC)
+	next, err = NextRunTime("0 2 * * *", startTime, now)
+	if err != nil {
+		t.Fatalf("failed to get next run time: %v", err)
+	}
+	if !next.Equal(startTime) {
+		t.Errorf("unexpected next run time: %v != %v", next, startTime)
+	}
+}
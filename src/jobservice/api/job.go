@@ -0,0 +1,254 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/astaxie/beego/context"
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/job"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+const (
+	// the interval at which the log file is checked for new content when following the log
+	logPollInterval = time.Second
+	// the interval at which the status of the job is checked when following the log
+	statusPollInterval = 10 * time.Second
+)
+
+// Job handles /api/jobs/:kind/:id/status /api/jobs/:kind/:id/log /api/jobs/:kind/:id/actions,
+// which apply to the jobs of all kinds
+type Job struct {
+	api.BaseAPI
+	jobID int64
+	job   *models.RepJob
+}
+
+// JobStatus holds the status of a job returned by /api/jobs/:kind/:id/status
+type JobStatus struct {
+	ID              int64     `json:"id"`
+	Kind            string    `json:"kind"`
+	Status          string    `json:"status"`
+	RetryCount      int       `json:"retry_count"`
+	NextAttemptTime time.Time `json:"next_attempt_time"`
+	CreationTime    time.Time `json:"creation_time"`
+	UpdateTime      time.Time `json:"update_time"`
+}
+
+// Prepare authenticates the request and loads the job of the kind
+func (j *Job) Prepare() {
+	authenticate(&j.BaseAPI)
+
+	kind := j.Ctx.Input.Param(":kind")
+	if !job.HasJobType(kind) {
+		j.CustomAbort(http.StatusNotFound, fmt.Sprintf("Unsupported kind of job: %s", kind))
+	}
+	idStr := j.Ctx.Input.Param(":id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Errorf("Error parsing job id: %s, error: %v", idStr, err)
+		j.CustomAbort(http.StatusBadRequest, "Invalid job id")
+	}
+
+	rj, err := dao.GetRepJob(id)
+	if err != nil {
+		log.Errorf("Failed to get job %d, error: %v", id, err)
+		j.CustomAbort(http.StatusInternalServerError, fmt.Sprintf("Failed to get job, id: %d", id))
+	}
+	if rj == nil || rj.Kind != kind {
+		j.CustomAbort(http.StatusNotFound, fmt.Sprintf("Job not found, kind: %s, id: %d", kind, id))
+	}
+	j.jobID = id
+	j.job = rj
+}
+
+// GetStatus returns the status of the job
+func (j *Job) GetStatus() {
+	j.Data["json"] = &JobStatus{
+		ID:              j.job.ID,
+		Kind:            j.job.Kind,
+		Status:          j.job.Status,
+		RetryCount:      j.job.RetryCount,
+		NextAttemptTime: j.job.NextAttemptTime,
+		CreationTime:    j.job.CreationTime,
+		UpdateTime:      j.job.UpdateTime,
+	}
+	j.ServeJSON()
+}
+
+// HandleAction supports some operations to a single job:
+// "stop" stops the job if it is running, "cancel" cancels the job if it
+// is waiting in the job queue, "rerun" puts the job back to the job queue
+// if it has completed.
+func (j *Job) HandleAction() {
+	var data RepActionReq
+	j.DecodeJSONReq(&data)
+
+	jid := j.jobID
+	switch data.Action {
+	case "stop":
+		if j.job.Status != models.JobRunning || !job.WorkerPool.StopJob(jid) {
+			j.RenderError(http.StatusConflict, fmt.Sprintf("Job %d is not running on this job service", jid))
+			return
+		}
+	case "cancel":
+		canceled, err := dao.CancelRepJob(jid)
+		if err != nil {
+			log.Errorf("Failed to cancel job %d, error: %v", jid, err)
+			j.RenderError(http.StatusInternalServerError, "Failed to cancel job")
+			return
+		}
+		if !canceled {
+			j.RenderError(http.StatusConflict, fmt.Sprintf("Job %d is not pending or retrying", jid))
+			return
+		}
+	case "rerun":
+		reset, err := dao.ResetRepJob(jid)
+		if err != nil {
+			log.Errorf("Failed to reset job %d, error: %v", jid, err)
+			j.RenderError(http.StatusInternalServerError, "Failed to rerun job")
+			return
+		}
+		if !reset {
+			j.RenderError(http.StatusConflict, fmt.Sprintf("Job %d has not completed", jid))
+			return
+		}
+		job.Schedule(jid)
+	default:
+		log.Errorf("Unrecognized action: %s", data.Action)
+		j.RenderError(http.StatusBadRequest, fmt.Sprintf("Unrecongized action: %s", data.Action))
+		return
+	}
+}
+
+// GetLog gets logs of the job. The parameter "offset" specifies the byte offset from
+// which the log is returned, and the offset right after the returned log is set in the
+// header "X-Log-Offset". If the parameter "follow" is true, the log is streamed as it
+// is written until the job completes or the client disconnects, and the offset is sent
+// in the trailer "X-Log-Offset" instead.
+func (j *Job) GetLog() {
+	jid := j.jobID
+	offset, err := j.GetInt64("offset", 0)
+	if err != nil || offset < 0 {
+		j.RenderError(http.StatusBadRequest, "Invalid offset")
+		return
+	}
+	follow, err := j.GetBool("follow", false)
+	if err != nil {
+		j.RenderError(http.StatusBadRequest, "Invalid follow")
+		return
+	}
+
+	logFile := utils.GetJobLogPath(jid)
+	f, err := os.Open(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			j.RenderError(http.StatusNotFound, fmt.Sprintf("Log of job %d not found", jid))
+			return
+		}
+		log.Errorf("Failed to open log file %s, error: %v", logFile, err)
+		j.RenderError(http.StatusInternalServerError, "Failed to open log file")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Errorf("Failed to get the info of log file %s, error: %v", logFile, err)
+		j.RenderError(http.StatusInternalServerError, "Failed to open log file")
+		return
+	}
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		log.Errorf("Failed to seek log file %s to %d, error: %v", logFile, offset, err)
+		j.RenderError(http.StatusInternalServerError, "Failed to read log file")
+		return
+	}
+
+	w := j.Ctx.ResponseWriter
+	w.Header().Set(http.CanonicalHeaderKey("Content-Type"), "text/plain")
+	if !follow {
+		w.Header().Set(http.CanonicalHeaderKey("X-Log-Offset"), strconv.FormatInt(info.Size(), 10))
+		w.Header().Set(http.CanonicalHeaderKey("Content-Length"), strconv.FormatInt(info.Size()-offset, 10))
+		if _, err = io.CopyN(w, f, info.Size()-offset); err != nil {
+			log.Errorf("Failed to write log of job %d to response, error: %v", jid, err)
+		}
+		return
+	}
+
+	w.Header().Set(http.CanonicalHeaderKey("Trailer"), "X-Log-Offset")
+	offset = followLog(jid, f, offset, w)
+	w.Header().Set(http.CanonicalHeaderKey("X-Log-Offset"), strconv.FormatInt(offset, 10))
+}
+
+// followLog writes the log from the offset to the response as it is written until
+// the job completes or the client disconnects, it returns the offset right after
+// the log written. The status of the job is checked less often than the log file.
+func followLog(jobID int64, f *os.File, offset int64, w *context.Response) int64 {
+	closed := w.CloseNotify()
+	var checked time.Time
+	for {
+		completed := false
+		if time.Since(checked) >= statusPollInterval {
+			completed = jobCompleted(jobID)
+			checked = time.Now()
+		}
+		n, err := io.Copy(w, f)
+		offset += n
+		if err != nil {
+			log.Errorf("Failed to write log of job %d to response, error: %v", jobID, err)
+			return offset
+		}
+		w.Flush()
+		if completed {
+			return offset
+		}
+		select {
+		case <-closed:
+			return offset
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// jobCompleted returns true if the job will not write log anymore
+func jobCompleted(jobID int64) bool {
+	j, err := dao.GetRepJob(jobID)
+	if err != nil {
+		log.Errorf("Failed to get job %d, error: %v", jobID, err)
+		return false
+	}
+	if j == nil {
+		return true
+	}
+	switch j.Status {
+	case models.JobFinished, models.JobError, models.JobStopped, models.JobCanceled:
+		return true
+	}
+	return false
+}
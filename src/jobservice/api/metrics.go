@@ -0,0 +1,85 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/job"
+	"github.com/vmware/harbor/src/jobservice/metrics"
+)
+
+// Metrics handles /metrics, it exposes the metrics of job service in Prometheus text format
+type Metrics struct {
+	api.BaseAPI
+}
+
+// Get collects the gauges and writes all metrics to the response.
+func (m *Metrics) Get() {
+	counts, err := dao.CountQueuedRepJobs()
+	if err != nil {
+		log.Errorf("Failed to count the jobs in job queue, error: %v", err)
+		m.RenderError(http.StatusInternalServerError, "Failed to count the jobs in job queue")
+		return
+	}
+	metrics.QueueDepth.Reset()
+	for _, c := range counts {
+		metrics.QueueDepth.Set(float64(c.Count), strconv.FormatInt(c.PolicyID, 10),
+			strconv.FormatInt(c.TargetID, 10), c.Operation, c.Status)
+	}
+
+	removeDeleted()
+
+	busy := job.BusyWorkers()
+	metrics.Workers.Set(float64(busy), "busy")
+	metrics.Workers.Set(float64(config.MaxJobWorkers()-busy), "idle")
+
+	m.Ctx.ResponseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.Write(m.Ctx.ResponseWriter); err != nil {
+		log.Errorf("Failed to write metrics, error: %v", err)
+	}
+}
+
+// removeDeleted removes the series of the policies and targets which have been deleted
+func removeDeleted() {
+	policyIDs, err := dao.GetRepPolicyIDs()
+	if err != nil {
+		log.Errorf("Failed to get policies, error: %v", err)
+		return
+	}
+	targets, err := dao.FilterRepTargets("")
+	if err != nil {
+		log.Errorf("Failed to get targets, error: %v", err)
+		return
+	}
+
+	policies := map[string]bool{}
+	for _, id := range policyIDs {
+		policies[strconv.FormatInt(id, 10)] = true
+	}
+	metrics.Retain("policy_id", policies)
+
+	targetIDs := map[string]bool{}
+	for _, target := range targets {
+		targetIDs[strconv.FormatInt(target.ID, 10)] = true
+	}
+	metrics.Retain("target_id", targetIDs)
+}
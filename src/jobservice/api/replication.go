@@ -16,25 +16,23 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
 	"strconv"
 
 	"github.com/vmware/harbor/src/common/api"
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/jobservice/job"
 	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/retention"
+	"github.com/vmware/harbor/src/jobservice/scheduler"
 	"github.com/vmware/harbor/src/jobservice/utils"
 	"github.com/vmware/harbor/src/common/models"
-	u "github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
-// ReplicationJob handles /api/replicationJobs /api/replicationJobs/:id/log
-// /api/replicationJobs/actions
+// ReplicationJob handles /api/replicationJobs /api/replicationJobs/actions, the log and
+// the actions of a single replication job are handled by Job
 type ReplicationJob struct {
 	api.BaseAPI
 }
@@ -45,26 +43,32 @@ type ReplicationReq struct {
 	Repo      string   `json:"repository"`
 	Operation string   `json:"operation"`
 	TagList   []string `json:"tags"`
+	// Digest pins the only tag to the digest, e.g. the one of the push event which
+	// triggers the replication
+	Digest string `json:"digest"`
+	// Trigger is what triggers the replication, it is "manual" by default
+	Trigger string `json:"trigger"`
 }
 
 // Prepare ...
 func (rj *ReplicationJob) Prepare() {
-	rj.authenticate()
+	authenticate(&rj.BaseAPI)
 }
 
-func (rj *ReplicationJob) authenticate() {
-	cookie, err := rj.Ctx.Request.Cookie(models.UISecretCookie)
+// authenticate checks the secret of UI carried by the request
+func authenticate(a *api.BaseAPI) {
+	cookie, err := a.Ctx.Request.Cookie(models.UISecretCookie)
 	if err != nil && err != http.ErrNoCookie {
 		log.Errorf("failed to get cookie %s: %v", models.UISecretCookie, err)
-		rj.CustomAbort(http.StatusInternalServerError, "")
+		a.CustomAbort(http.StatusInternalServerError, "")
 	}
 
 	if err == http.ErrNoCookie {
-		rj.CustomAbort(http.StatusUnauthorized, "")
+		a.CustomAbort(http.StatusUnauthorized, "")
 	}
 
 	if cookie.Value != config.UISecret() {
-		rj.CustomAbort(http.StatusForbidden, "")
+		a.CustomAbort(http.StatusForbidden, "")
 	}
 }
 
@@ -84,16 +88,33 @@ func (rj *ReplicationJob) Post() {
 		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Policy not found, id: %d", data.PolicyID))
 		return
 	}
+	defaultOp := models.RepOpTransfer
+	if p.Direction == models.RepDirectionPull {
+		defaultOp = models.RepOpPull
+	}
+	trigger := data.Trigger
+	if len(trigger) == 0 {
+		trigger = models.RepTriggerManual
+	}
+	execution := job.NewExecution(p.ID, trigger)
+	defer execution.Close()
 	if len(data.Repo) == 0 { // sync all repositories
-		repoList, err := getRepoList(p.ProjectID)
+		repoList, err := utils.GetPolicyRepoList(p)
 		if err != nil {
-			log.Errorf("Failed to get repository list, project id: %d, error: %v", p.ProjectID, err)
+			log.Errorf("Failed to get repository list, policy id: %d, error: %v", p.ID, err)
 			rj.RenderError(http.StatusInternalServerError, err.Error())
 			return
 		}
 		log.Debugf("repo list: %v", repoList)
 		for _, repo := range repoList {
-			err := rj.addJob(repo, data.PolicyID, models.RepOpTransfer)
+			if !p.MatchRepository(repo) {
+				log.Debugf("Repository %s is not selected by the filters of policy %d, skip", repo, p.ID)
+				continue
+			}
+			err := execution.AddJob(models.RepJob{
+				Repository: repo,
+				Operation:  defaultOp,
+			})
 			if err != nil {
 				log.Errorf("Failed to insert job record, error: %v", err)
 				rj.RenderError(http.StatusInternalServerError, err.Error())
@@ -105,9 +126,34 @@ func (rj *ReplicationJob) Post() {
 		if len(data.Operation) > 0 {
 			op = data.Operation
 		} else {
-			op = models.RepOpTransfer
+			op = defaultOp
+		}
+		if !job.IsRepOperation(op) {
+			rj.RenderError(http.StatusBadRequest, fmt.Sprintf("Unsupported operation: %s", op))
+			return
+		}
+		if (op == models.RepOpPull) != (p.Direction == models.RepDirectionPull) {
+			rj.RenderError(http.StatusBadRequest, fmt.Sprintf("Operation %s is not allowed by the %s policy", op, p.Direction))
+			return
+		}
+		if len(data.Digest) > 0 && (op == models.RepOpDelete || len(data.TagList) != 1) {
+			rj.RenderError(http.StatusBadRequest, "Digest is only allowed for replicating a single tag")
+			return
+		}
+		tags := data.TagList
+		if len(tags) > 0 {
+			tags = p.FilterTags(tags)
+		}
+		if !p.MatchRepository(data.Repo) || len(data.TagList) > 0 && len(tags) == 0 {
+			log.Debugf("Repository %s, tags %v are not selected by the filters of policy %d, skip", data.Repo, data.TagList, p.ID)
+			return
 		}
-		err := rj.addJob(data.Repo, data.PolicyID, op, data.TagList...)
+		err := execution.AddJob(models.RepJob{
+			Repository: data.Repo,
+			Operation:  op,
+			TagList:    tags,
+			Digest:     data.Digest,
+		})
 		if err != nil {
 			log.Errorf("Failed to insert job record, error: %v", err)
 			rj.RenderError(http.StatusInternalServerError, err.Error())
@@ -116,23 +162,6 @@ func (rj *ReplicationJob) Post() {
 	}
 }
 
-func (rj *ReplicationJob) addJob(repo string, policyID int64, operation string, tags ...string) error {
-	j := models.RepJob{
-		Repository: repo,
-		PolicyID:   policyID,
-		Operation:  operation,
-		TagList:    tags,
-	}
-	log.Debugf("Creating job for repo: %s, policy: %d", repo, policyID)
-	id, err := dao.AddRepJob(j)
-	if err != nil {
-		return err
-	}
-	log.Debugf("Send job to scheduler, job id: %d", id)
-	job.Schedule(id)
-	return nil
-}
-
 // RepActionReq holds informations of request for /api/replicationJobs/actions
 type RepActionReq struct {
 	PolicyID int64  `json:"policy_id"`
@@ -143,80 +172,203 @@ type RepActionReq struct {
 func (rj *ReplicationJob) HandleAction() {
 	var data RepActionReq
 	rj.DecodeJSONReq(&data)
-	//Currently only support stop action
-	if data.Action != "stop" {
+	switch data.Action {
+	case "stop":
+		jobs, err := dao.GetRepJobToStop(data.PolicyID)
+		if err != nil {
+			log.Errorf("Failed to get jobs to stop, error: %v", err)
+			rj.RenderError(http.StatusInternalServerError, "Faild to get jobs to stop")
+			return
+		}
+		var jobIDList []int64
+		for _, j := range jobs {
+			jobIDList = append(jobIDList, j.ID)
+		}
+		job.WorkerPool.StopJobs(jobIDList)
+	case "reschedule":
+		if err := scheduler.DefaultScheduler.Reschedule(data.PolicyID); err != nil {
+			log.Errorf("Failed to reschedule policy %d, error: %v", data.PolicyID, err)
+			rj.RenderError(http.StatusInternalServerError, "Failed to reschedule policy")
+			return
+		}
+	default:
 		log.Errorf("Unrecognized action: %s", data.Action)
 		rj.RenderError(http.StatusBadRequest, fmt.Sprintf("Unrecongized action: %s", data.Action))
 		return
 	}
-	jobs, err := dao.GetRepJobToStop(data.PolicyID)
+}
+
+// Purge removes the completed jobs and their logs which are not retained by the
+// retention policy, if the parameter "dry_run" is true, it only reports the jobs
+// and logs which would be removed.
+func (rj *ReplicationJob) Purge() {
+	dryRun, err := rj.GetBool("dry_run", false)
 	if err != nil {
-		log.Errorf("Failed to get jobs to stop, error: %v", err)
-		rj.RenderError(http.StatusInternalServerError, "Faild to get jobs to stop")
+		rj.RenderError(http.StatusBadRequest, "Invalid dry_run")
 		return
 	}
-	var jobIDList []int64
-	for _, j := range jobs {
-		jobIDList = append(jobIDList, j.ID)
-	}
-	job.WorkerPool.StopJobs(jobIDList)
-}
 
-// GetLog gets logs of the job
-func (rj *ReplicationJob) GetLog() {
-	idStr := rj.Ctx.Input.Param(":id")
-	jid, err := strconv.ParseInt(idStr, 10, 64)
+	result, err := retention.Purge(retention.DefaultPolicy(), dryRun)
 	if err != nil {
-		log.Errorf("Error parsing job id: %s, error: %v", idStr, err)
-		rj.RenderError(http.StatusBadRequest, "Invalid job id")
+		log.Errorf("Failed to purge jobs, error: %v", err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to purge jobs")
 		return
 	}
-	logFile := utils.GetJobLogPath(jid)
-	rj.Ctx.Output.Download(logFile)
-}
 
-// calls the api from UI to get repo list
-func getRepoList(projectID int64) ([]string, error) {
-	repositories := []string{}
+	rj.Data["json"] = result
+	rj.ServeJSON()
+}
 
-	client := &http.Client{}
-	uiURL := config.LocalUIURL()
-	next := "/api/repositories?project_id=" + strconv.Itoa(int(projectID))
-	for len(next) != 0 {
-		req, err := http.NewRequest("GET", uiURL+next, nil)
-		if err != nil {
-			return repositories, err
-		}
+// RepReconcileReq holds informations of request for /api/replicationJobs/reconcile
+type RepReconcileReq struct {
+	PolicyID int64 `json:"policy_id"`
+	Apply    bool  `json:"apply"`
+}
 
-		req.AddCookie(&http.Cookie{Name: models.UISecretCookie, Value: config.UISecret()})
+// Reconcile compares the tags of the repositories replicated by the policy on the source
+// and destination registries, and reports the missing, stale and extra tags of the ones
+// which differ. If "apply" is true, it also creates the jobs which transfer the missing
+// and stale tags, and the jobs which delete the extra tags for push policies.
+func (rj *ReplicationJob) Reconcile() {
+	var data RepReconcileReq
+	rj.DecodeJSONReq(&data)
+	p, err := dao.GetRepPolicy(data.PolicyID)
+	if err != nil {
+		log.Errorf("Failed to get policy, error: %v", err)
+		rj.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to get policy, id: %d", data.PolicyID))
+		return
+	}
+	if p == nil {
+		log.Errorf("Policy not found, id: %d", data.PolicyID)
+		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Policy not found, id: %d", data.PolicyID))
+		return
+	}
+	if data.Apply && p.Enabled == 0 {
+		rj.RenderError(http.StatusBadRequest, fmt.Sprintf("Policy %d is disabled", p.ID))
+		return
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return repositories, err
+	repoList, err := utils.GetPolicyRepoList(p)
+	if err != nil {
+		log.Errorf("Failed to get repository list, policy id: %d, error: %v", p.ID, err)
+		rj.RenderError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the repositories only on the destination have extra tags
+	dstRepoList, err := utils.GetPolicyDstRepoList(p)
+	if err != nil {
+		log.Errorf("Failed to get repository list of the destination, policy id: %d, error: %v", p.ID, err)
+		rj.RenderError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	repos := map[string]bool{}
+	for _, repo := range repoList {
+		repos[repo] = true
+	}
+	for _, repo := range dstRepoList {
+		if !repos[repo] {
+			repoList = append(repoList, repo)
+			repos[repo] = true
 		}
-		defer resp.Body.Close()
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			dump, _ := httputil.DumpResponse(resp, true)
-			log.Debugf("response: %q", dump)
-			return repositories, fmt.Errorf("Unexpected status code when getting repository list: %d", resp.StatusCode)
+	defaultOp := models.RepOpTransfer
+	if p.Direction == models.RepDirectionPull {
+		defaultOp = models.RepOpPull
+	}
+	execution := job.NewExecution(p.ID, models.RepTriggerManual)
+	defer execution.Close()
+	diffs := []*models.RepDiff{}
+	for _, repo := range repoList {
+		if !p.MatchRepository(repo) {
+			continue
 		}
-
-		body, err := ioutil.ReadAll(resp.Body)
+		diff, err := job.DiffRepository(p, repo)
 		if err != nil {
-			return repositories, err
+			log.Errorf("Failed to compare tags of repository %s, policy id: %d, error: %v", repo, p.ID, err)
+			diffs = append(diffs, &models.RepDiff{
+				Repository: repo,
+				Error:      err.Error(),
+			})
+			continue
+		}
+		if diff.Empty() {
+			continue
 		}
+		diffs = append(diffs, diff)
 
-		var list []string
-		if err = json.Unmarshal(body, &list); err != nil {
-			return repositories, err
+		if !data.Apply {
+			continue
+		}
+		if tags := append(diff.Missing, diff.Stale...); len(tags) > 0 {
+			err := execution.AddJob(models.RepJob{
+				Repository: repo,
+				Operation:  defaultOp,
+				TagList:    tags,
+			})
+			if err != nil {
+				log.Errorf("Failed to insert job record, error: %v", err)
+				rj.RenderError(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		// the extra tags of pull policies are local images, they are only reported, so are the
+		// shared tags as deleting their manifests deletes the tags kept on the destination
+		if p.Direction != models.RepDirectionPull && len(diff.Extra) > 0 {
+			err := execution.AddJob(models.RepJob{
+				Repository: repo,
+				Operation:  models.RepOpDelete,
+				TagList:    diff.Extra,
+			})
+			if err != nil {
+				log.Errorf("Failed to insert job record, error: %v", err)
+				rj.RenderError(http.StatusInternalServerError, err.Error())
+				return
+			}
 		}
+	}
 
-		repositories = append(repositories, list...)
+	rj.Data["json"] = diffs
+	rj.ServeJSON()
+}
 
-		links := u.ParseLink(resp.Header.Get(http.CanonicalHeaderKey("link")))
-		next = links.Next()
+// RetryExecution puts the failed jobs of the execution back to the job queue
+func (rj *ReplicationJob) RetryExecution() {
+	idStr := rj.Ctx.Input.Param(":id")
+	eid, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Errorf("Error parsing execution id: %s, error: %v", idStr, err)
+		rj.RenderError(http.StatusBadRequest, "Invalid execution id")
+		return
 	}
 
-	return repositories, nil
+	e, err := dao.GetRepExecution(eid)
+	if err != nil {
+		log.Errorf("Failed to get execution %d, error: %v", eid, err)
+		rj.RenderError(http.StatusInternalServerError, fmt.Sprintf("Failed to get execution, id: %d", eid))
+		return
+	}
+	if e == nil {
+		rj.RenderError(http.StatusNotFound, fmt.Sprintf("Execution not found, id: %d", eid))
+		return
+	}
+
+	jobs, err := dao.GetRepJobsByExecution(eid, models.JobError)
+	if err != nil {
+		log.Errorf("Failed to get failed jobs of execution %d, error: %v", eid, err)
+		rj.RenderError(http.StatusInternalServerError, "Failed to get failed jobs")
+		return
+	}
+	for _, j := range jobs {
+		reset, err := dao.ResetRepJob(j.ID)
+		if err != nil {
+			log.Errorf("Failed to reset job %d, error: %v", j.ID, err)
+			rj.RenderError(http.StatusInternalServerError, "Failed to retry jobs")
+			return
+		}
+		// the job may have been rerun by others
+		if reset {
+			job.Schedule(j.ID)
+		}
+	}
 }
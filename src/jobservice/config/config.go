@@ -19,12 +19,23 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/astaxie/beego"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
-const defaultMaxWorkers int = 10
+const (
+	defaultMaxWorkers       int     = 10
+	defaultMaxRetries       int     = 5
+	defaultRetryInterval    int     = 60
+	defaultRetryMaxInterval int     = 3600
+	defaultRetryMultiplier  float64 = 2
+	defaultDrainTimeout     int     = 60
+	// the health of targets is checked every minute and the results are kept for a week
+	defaultHealthCheckInterval int = 60
+	defaultHealthHistoryDays   int = 7
+)
 
 var maxJobWorkers int
 var localUIURL string
@@ -33,6 +44,19 @@ var logDir string
 var uiSecret string
 var secretKey string
 var verifyRemoteCert string
+var maxJobRetries int
+var jobRetryInterval time.Duration
+var jobRetryMaxInterval time.Duration
+var jobRetryMultiplier float64
+var jobRetentionDays int
+var jobErrorRetentionDays int
+var jobRetentionCount int
+var jobDrainTimeout time.Duration
+var blobChunkSize int64
+var blobTransferConcurrency int
+var targetMaxTransfers int
+var targetHealthCheckInterval time.Duration
+var targetHealthHistoryDays int
 
 func init() {
 	maxWorkersEnv := os.Getenv("MAX_JOB_WORKERS")
@@ -43,6 +67,31 @@ func init() {
 		maxJobWorkers = defaultMaxWorkers
 	}
 
+	maxJobRetries = parseInt("MAX_JOB_RETRIES", defaultMaxRetries)
+	jobRetryInterval = time.Duration(parseInt("JOB_RETRY_INTERVAL", defaultRetryInterval)) * time.Second
+	jobRetryMaxInterval = time.Duration(parseInt("JOB_RETRY_MAX_INTERVAL", defaultRetryMaxInterval)) * time.Second
+	jobRetryMultiplier = defaultRetryMultiplier
+	if v := os.Getenv("JOB_RETRY_MULTIPLIER"); len(v) != 0 {
+		jobRetryMultiplier, err = strconv.ParseFloat(v, 64)
+		if err != nil || jobRetryMultiplier < 1 {
+			log.Warningf("Invalid job retry multiplier setting: %s, the default value: %.1f will be used", v, defaultRetryMultiplier)
+			jobRetryMultiplier = defaultRetryMultiplier
+		}
+	}
+
+	jobRetentionDays = parseInt("JOB_RETENTION_DAYS", 0)
+	jobErrorRetentionDays = parseInt("JOB_ERROR_RETENTION_DAYS", 0)
+	jobRetentionCount = parseInt("JOB_RETENTION_COUNT", 0)
+	jobDrainTimeout = time.Duration(parseInt("JOB_DRAIN_TIMEOUT", defaultDrainTimeout)) * time.Second
+	blobChunkSize = int64(parseInt("BLOB_CHUNK_SIZE", 0)) * 1024 * 1024
+	blobTransferConcurrency = parseInt("BLOB_TRANSFER_CONCURRENCY", 1)
+	if blobTransferConcurrency < 1 {
+		blobTransferConcurrency = 1
+	}
+	targetMaxTransfers = parseInt("TARGET_MAX_TRANSFERS", 0)
+	targetHealthCheckInterval = time.Duration(parseInt("TARGET_HEALTH_CHECK_INTERVAL", defaultHealthCheckInterval)) * time.Second
+	targetHealthHistoryDays = parseInt("TARGET_HEALTH_HISTORY_DAYS", defaultHealthHistoryDays)
+
 	localRegURL = os.Getenv("REGISTRY_URL")
 	if len(localRegURL) == 0 {
 		localRegURL = "http://registry:5000"
@@ -93,6 +142,17 @@ func init() {
 	}
 
 	log.Debugf("config: maxJobWorkers: %d", maxJobWorkers)
+	log.Debugf("config: maxJobRetries: %d", maxJobRetries)
+	log.Debugf("config: jobRetryInterval: %v, jobRetryMaxInterval: %v, jobRetryMultiplier: %.1f",
+		jobRetryInterval, jobRetryMaxInterval, jobRetryMultiplier)
+	log.Debugf("config: jobRetentionDays: %d, jobErrorRetentionDays: %d, jobRetentionCount: %d",
+		jobRetentionDays, jobErrorRetentionDays, jobRetentionCount)
+	log.Debugf("config: jobDrainTimeout: %v", jobDrainTimeout)
+	log.Debugf("config: blobChunkSize: %d", blobChunkSize)
+	log.Debugf("config: blobTransferConcurrency: %d, targetMaxTransfers: %d",
+		blobTransferConcurrency, targetMaxTransfers)
+	log.Debugf("config: targetHealthCheckInterval: %v, targetHealthHistoryDays: %d",
+		targetHealthCheckInterval, targetHealthHistoryDays)
 	log.Debugf("config: localUIURL: %s", localUIURL)
 	log.Debugf("config: localRegURL: %s", localRegURL)
 	log.Debugf("config: verifyRemoteCert: %s", verifyRemoteCert)
@@ -105,6 +165,91 @@ func MaxJobWorkers() int {
 	return maxJobWorkers
 }
 
+// parseInt reads a non-negative integer from the environment variable, the default
+// value is returned if the variable is not set or invalid, only the invalid one is warned
+func parseInt(key string, defaultValue int) int {
+	s := os.Getenv(key)
+	if len(s) == 0 {
+		return defaultValue
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		log.Warningf("Invalid setting of %s: %s, the default value: %d will be used", key, s, defaultValue)
+		return defaultValue
+	}
+	return v
+}
+
+// MaxJobRetries returns the maximum number of retries of a job before it is marked as error
+func MaxJobRetries() int {
+	return maxJobRetries
+}
+
+// JobRetryInterval returns the interval before the first retry of a job
+func JobRetryInterval() time.Duration {
+	return jobRetryInterval
+}
+
+// JobRetryMaxInterval returns the upper bound of the interval between retries
+func JobRetryMaxInterval() time.Duration {
+	return jobRetryMaxInterval
+}
+
+// JobRetryMultiplier returns the factor by which the interval grows after each retry
+func JobRetryMultiplier() float64 {
+	return jobRetryMultiplier
+}
+
+// JobRetentionDays returns the days for which the completed jobs are retained, 0 means forever
+func JobRetentionDays() int {
+	return jobRetentionDays
+}
+
+// JobErrorRetentionDays returns the days for which the failed jobs are retained, 0 means forever
+func JobErrorRetentionDays() int {
+	return jobErrorRetentionDays
+}
+
+// JobRetentionCount returns the count of completed jobs retained for each policy, 0 means no limit
+func JobRetentionCount() int {
+	return jobRetentionCount
+}
+
+// JobDrainTimeout returns how long the job service waits for the running jobs to reach
+// a state in which they can be resumed later when it is shutting down
+func JobDrainTimeout() time.Duration {
+	return jobDrainTimeout
+}
+
+// BlobChunkSize returns the size in bytes of the chunks in which the blobs are pushed to
+// the destination registry, 0 means the blobs are pushed in a single request
+func BlobChunkSize() int64 {
+	return blobChunkSize
+}
+
+// BlobTransferConcurrency returns the count of blobs a replication job transfers concurrently
+func BlobTransferConcurrency() int {
+	return blobTransferConcurrency
+}
+
+// TargetMaxTransfers returns the max count of blobs transferred concurrently to or from
+// one target by all replication jobs, 0 means no limit
+func TargetMaxTransfers() int {
+	return targetMaxTransfers
+}
+
+// TargetHealthCheckInterval returns the interval at which the health of the targets is
+// checked, 0 means the health is not checked
+func TargetHealthCheckInterval() time.Duration {
+	return targetHealthCheckInterval
+}
+
+// TargetHealthHistoryDays returns the days after which the results of the health checks
+// of targets are removed, 0 means forever
+func TargetHealthHistoryDays() int {
+	return targetHealthHistoryDays
+}
+
 // LocalUIURL returns the local ui url, job service will use this URL to call API hosted on ui process
 func LocalUIURL() string {
 	return localUIURL
@@ -0,0 +1,171 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package health
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/job"
+	"github.com/vmware/harbor/src/jobservice/metrics"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// the name of the lease held by the job service instance which checks the health of targets
+const leaseName = "target_health_check"
+
+// Start checks the health of all targets periodically if the health check is enabled,
+// only the job service instance holding the lease checks them, like the jobs claimed
+// from the job queue, so the results are not recorded repeatedly by every instance.
+// The lease outlives two intervals so it is renewed before it expires.
+func Start() {
+	interval := config.TargetHealthCheckInterval()
+	if interval == 0 {
+		log.Info("The health check of targets is disabled")
+		return
+	}
+	go func() {
+		for {
+			now := time.Now()
+			acquired, err := dao.AcquireLease(leaseName, job.Owner(), now.Add(2*interval), now)
+			if err != nil {
+				log.Errorf("Failed to acquire the lease of the health check, error: %v", err)
+			} else if acquired {
+				CheckTargets()
+				purge()
+			} else {
+				// the metrics are exposed by the instance holding the lease
+				metrics.TargetUp.Reset()
+				metrics.TargetLatency.Reset()
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// CheckTargets checks the health of all targets concurrently and records the results
+func CheckTargets() {
+	targets, err := dao.FilterRepTargets("")
+	if err != nil {
+		log.Errorf("Failed to get targets, error: %v", err)
+		return
+	}
+
+	statuses := make([]*models.RepTargetStatus, len(targets))
+	wg := sync.WaitGroup{}
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *models.RepTarget) {
+			defer wg.Done()
+			statuses[i] = Check(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	// the deleted targets are removed from the metrics
+	metrics.TargetUp.Reset()
+	metrics.TargetLatency.Reset()
+	for _, status := range statuses {
+		if _, err := dao.AddRepTargetStatus(*status); err != nil {
+			log.Errorf("Failed to record the status of target %d, error: %v", status.TargetID, err)
+		}
+
+		id := strconv.FormatInt(status.TargetID, 10)
+		up := 0.0
+		if status.Reachable {
+			up = 1
+		} else {
+			log.Warningf("Target %d is unreachable, its jobs are held, error: %s", status.TargetID, status.Error)
+		}
+		metrics.TargetUp.Set(up, id)
+		metrics.TargetLatency.Set(float64(status.Latency)/1000, id)
+	}
+}
+
+// Check pings the target and returns the result, the target is considered reachable
+// if it responds to the ping without a server error, even if it rejects the credential
+func Check(target *models.RepTarget) *models.RepTargetStatus {
+	status := &models.RepTargetStatus{
+		TargetID: target.ID,
+	}
+
+	start := time.Now()
+	err := ping(target)
+	status.Latency = int64(time.Since(start) / time.Millisecond)
+	if err == nil {
+		status.Reachable = true
+		status.AuthValid = true
+		return status
+	}
+
+	status.Error = err.Error()
+	if regErr, ok := err.(*registry_error.Error); ok &&
+		(regErr.StatusCode == http.StatusUnauthorized || regErr.StatusCode == http.StatusForbidden) {
+		status.Reachable = true
+	}
+	return status
+}
+
+func ping(target *models.RepTarget) error {
+	password, transportConfig, err := utils.TargetCredential(target)
+	if err != nil {
+		return err
+	}
+
+	transport, err := registry.GetTransport(transportConfig)
+	if err != nil {
+		return err
+	}
+
+	credential := auth.NewBasicAuthCredential(target.Username, password)
+	authorizer := auth.NewStandardTokenAuthorizerWithTransport(credential, transport, "", "", "")
+	store, err := auth.NewAuthorizerStoreWithTransport(target.URL, transport, authorizer)
+	if err != nil {
+		return err
+	}
+
+	client, err := registry.NewRegistryWithTransport(target.URL, transport, store)
+	if err != nil {
+		return err
+	}
+	return client.Ping()
+}
+
+// purge removes the results of the health checks which are older than the history
+// retention, the latest result of each target is kept
+func purge() {
+	days := config.TargetHealthHistoryDays()
+	if days == 0 {
+		return
+	}
+	n, err := dao.DeleteRepTargetStatuses(time.Now().Add(-time.Duration(days) * 24 * time.Hour))
+	if err != nil {
+		log.Errorf("Failed to remove the history of the health of targets, error: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Debugf("%d results of the health checks of targets have been removed", n)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+func TestCheck(t *testing.T) {
+	newServer := func(code int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+	}
+
+	up := newServer(http.StatusOK)
+	defer up.Close()
+	unauthorized := newServer(http.StatusUnauthorized)
+	defer unauthorized.Close()
+	broken := newServer(http.StatusServiceUnavailable)
+	defer broken.Close()
+	down := newServer(http.StatusOK)
+	down.Close()
+
+	cases := []struct {
+		url       string
+		reachable bool
+		authValid bool
+	}{
+		{up.URL, true, true},
+		{unauthorized.URL, true, false},
+		{broken.URL, false, false},
+		{down.URL, false, false},
+	}
+	for _, c := range cases {
+		status := Check(&models.RepTarget{ID: 1, URL: c.url})
+		if status.Reachable != c.reachable || status.AuthValid != c.authValid {
+			t.Errorf("unexpected status of %s: %+v", c.url, status)
+		}
+		if !status.AuthValid && len(status.Error) == 0 {
+			t.Errorf("the error of %s is not recorded", c.url)
+		}
+	}
+}
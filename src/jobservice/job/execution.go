@@ -0,0 +1,84 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"strconv"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/metrics"
+)
+
+// Execution creates the jobs of a trigger of a policy, the execution is recorded
+// when its first job is added.
+type Execution struct {
+	policyID int64
+	trigger  string
+	id       int64 // 0 until the first job is added
+	jobs     int   // count of jobs added, the merged ones are excluded
+}
+
+// NewExecution returns an execution of the policy triggered by trigger
+func NewExecution(policyID int64, trigger string) *Execution {
+	return &Execution{
+		policyID: policyID,
+		trigger:  trigger,
+	}
+}
+
+// AddJob adds the job to the execution and sends it to the job queue, a job merged
+// into a pending job stays in the execution of the pending job.
+func (e *Execution) AddJob(j models.RepJob) error {
+	if e.id == 0 {
+		id, err := dao.AddRepExecution(models.RepExecution{
+			PolicyID: e.policyID,
+			Trigger:  e.trigger,
+		})
+		if err != nil {
+			return err
+		}
+		e.id = id
+	}
+
+	j.PolicyID = e.policyID
+	j.ExecutionID = e.id
+	log.Debugf("Creating job for repo: %s, policy: %d", j.Repository, j.PolicyID)
+	id, merged, err := dao.AddOrMergeRepJob(j)
+	if err != nil {
+		return err
+	}
+	if merged {
+		log.Debugf("Job merged into pending job: %d", id)
+		metrics.Coalesced.Inc(strconv.FormatInt(j.PolicyID, 10), j.Operation)
+		return nil
+	}
+	e.jobs++
+	log.Debugf("Send job to scheduler, job id: %d", id)
+	Schedule(id)
+	return nil
+}
+
+// Close removes the execution if all its jobs are merged into the pending ones
+func (e *Execution) Close() {
+	if e.id == 0 || e.jobs > 0 {
+		return
+	}
+	if err := dao.DeleteRepExecution(e.id); err != nil {
+		log.Warningf("Failed to delete execution %d without jobs, error: %v", e.id, err)
+	}
+}
@@ -2,8 +2,75 @@ package job
 
 import (
 	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
 )
 
 func TestMain(t *testing.T) {
 }
 
+func TestRetryBackoff(t *testing.T) {
+	cases := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{6, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+
+	for _, c := range cases {
+		d := retryBackoff(c.attempt, time.Minute, 30*time.Minute, 2)
+		if d != c.expected {
+			t.Errorf("unexpected backoff of attempt %d: %v != %v", c.attempt, d, c.expected)
+		}
+	}
+}
+
+
+func TestRegisterJobType(t *testing.T) {
+	if !HasJobType(models.JobKindReplication) {
+		t.Errorf("job type for kind %s is not registered", models.JobKindReplication)
+	}
+	for _, op := range []string{models.RepOpTransfer, models.RepOpPull, models.RepOpDelete} {
+		if !IsRepOperation(op) {
+			t.Errorf("operation %s of replication jobs is not supported", op)
+		}
+	}
+	if IsRepOperation("unknown") {
+		t.Errorf("operation unknown should not be supported")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("registering a job type twice should panic")
+		}
+	}()
+	RegisterJobType(models.JobKindReplication, jobTypes[models.JobKindReplication])
+}
+
+func TestDrainPolicy(t *testing.T) {
+	sm := &SM{}
+	sm.Init()
+	sm.JobID = 1
+	sm.labels = []string{"2", "3", models.RepOpTransfer}
+
+	if sm.drainPolicy("3") {
+		t.Errorf("the job of policy 2 should not be drained by policy 3")
+	}
+	if !sm.drainPolicy("2") || sm.getDesiredState() != models.JobPending {
+		t.Errorf("the job of policy 2 should be drained, desired state: %s", sm.getDesiredState())
+	}
+	if reason := sm.getDrainReason(); reason != "the time window of the policy has closed" {
+		t.Errorf("unexpected drain reason: %s", reason)
+	}
+
+	sm.setDesiredState(models.JobStopped)
+	if sm.drainPolicy("2") || sm.getDesiredState() != models.JobStopped {
+		t.Errorf("the job being stopped should not be drained, desired state: %s", sm.getDesiredState())
+	}
+}
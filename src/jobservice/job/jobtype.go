@@ -0,0 +1,73 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// ErrCanceled is returned by the parameter loader of a job type if the job
+// should be canceled rather than handled.
+var ErrCanceled = errors.New("the job has been canceled")
+
+// JobType defines a kind of job handled by the state machine. The jobs of all kinds share
+// the job queue, the worker pool, the retries and the APIs to query status, get logs and
+// stop jobs, the kind of a job selects the job type which handles it.
+type JobType struct {
+	// LoadParms loads the parameters of the job read from the job queue, which will be
+	// set as the Parms of the state machine.
+	LoadParms func(job *models.RepJob) (interface{}, error)
+	// AddTransitions adds the transitions to handle the job to the state machine, the
+	// transitions should start from the "running" state and end at the "finished" state.
+	AddTransitions func(sm *SM) error
+}
+
+// Labeled is implemented by the parameters of jobs which label their metrics, the labels
+// are "policy_id", "target_id" and "operation". The metrics of the jobs whose parameters
+// do not implement it are only labeled with the kind of job as the operation.
+type Labeled interface {
+	Labels() (policyID, targetID, operation string)
+}
+
+// RetryableError is implemented by the errors returned by state handlers to tell the
+// state machine the job failed but can be retried later.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+var jobTypes = map[string]*JobType{}
+
+// RegisterJobType registers the job type for the jobs of the kind, it should be called
+// before the workers are started, typically in the init function of a package.
+func RegisterJobType(kind string, t *JobType) {
+	if t == nil || t.LoadParms == nil || t.AddTransitions == nil {
+		panic(fmt.Sprintf("invalid job type for kind: %s", kind))
+	}
+	if _, ok := jobTypes[kind]; ok {
+		panic(fmt.Sprintf("job type for kind: %s is registered twice", kind))
+	}
+	jobTypes[kind] = t
+}
+
+// HasJobType returns whether the job type for the kind has been registered
+func HasJobType(kind string) bool {
+	_, ok := jobTypes[kind]
+	return ok
+}
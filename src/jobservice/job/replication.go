@@ -0,0 +1,288 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/replication"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+func init() {
+	RegisterJobType(models.JobKindReplication, &JobType{
+		LoadParms:      loadRepJobParm,
+		AddTransitions: addRepTransitions,
+	})
+}
+
+// repTransitions holds the functions which add the transitions to handle the
+// replication jobs of each operation
+var repTransitions = map[string]func(sm *SM) error{
+	models.RepOpTransfer: addImgTransferTransition,
+	models.RepOpPull:     addImgPullTransition,
+	models.RepOpDelete:   addImgDeleteTransition,
+}
+
+// IsRepOperation returns whether op is an operation supported by replication jobs
+func IsRepOperation(op string) bool {
+	_, ok := repTransitions[op]
+	return ok
+}
+
+// addRepTransitions adds the transitions to handle the replication job by its operation
+func addRepTransitions(sm *SM) error {
+	parms := sm.Parms.(*RepJobParm)
+	add, ok := repTransitions[parms.Operation]
+	if !ok {
+		return fmt.Errorf("unsupported operation: %s", parms.Operation)
+	}
+	return add(sm)
+}
+
+// RepJobParm wraps the parm of a replication job
+type RepJobParm struct {
+	LocalRegURL    string
+	PolicyID       int64
+	TargetID       int64
+	TargetURL      string
+	TargetUsername string
+	TargetPassword string
+	TargetType     int
+	// TargetInsecure, TargetCACert, TargetClientCert and TargetClientKey are the TLS
+	// settings of the target, the certificates and the key are PEM encoded
+	TargetInsecure   bool
+	TargetCACert     string
+	TargetClientCert string
+	TargetClientKey  string
+	// TargetProxyURL, TargetProxyUsername, TargetProxyPassword and TargetNoProxy are
+	// the settings of the proxy through which the target is connected
+	TargetProxyURL      string
+	TargetProxyUsername string
+	TargetProxyPassword string
+	TargetNoProxy       string
+	// TargetUpdateTime is the time the settings of the target were updated at
+	TargetUpdateTime time.Time
+	// BandwidthLimit is the max rate in KB per second of blobs transferred with the target
+	BandwidthLimit int64
+	Repository     string
+	Tags           []string
+	// Digest is the digest the only tag of the job is replicated at
+	Digest    string
+	Operation string
+	Insecure  bool
+	// TagFilter selects the tags to replicate or delete when the job has no tags, the tags
+	// are listed from the source registry for a transfer and from the target for a deletion
+	TagFilter func(tags []string) []string
+	// Progress is the progress left by the previous attempt of the job
+	Progress *models.RepJobProgress
+}
+
+// loadRepJobParm loads the parameters of a replication job from its policy and
+// target, the job will be canceled if the policy is disabled.
+func loadRepJobParm(job *models.RepJob) (interface{}, error) {
+	policy, err := dao.GetRepPolicy(job.PolicyID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get policy, error: %v", err)
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("The policy doesn't exist in DB, policy id:%d", job.PolicyID)
+	}
+	if policy.Enabled == 0 {
+		return nil, ErrCanceled
+	}
+	return newRepJobParm(policy, job)
+}
+
+// newRepJobParm returns the parameters to replicate the repository of the job by the policy
+func newRepJobParm(policy *models.RepPolicy, job *models.RepJob) (*RepJobParm, error) {
+	parms := &RepJobParm{
+		LocalRegURL: config.LocalRegURL(),
+		PolicyID:    policy.ID,
+		Repository:  job.Repository,
+		Tags:        job.TagList,
+		Digest:      job.Digest,
+		Operation:   job.Operation,
+		Insecure:    !config.VerifyRemoteCert(),
+		Progress:    job.Progress,
+	}
+	if policy.HasTagFilter() {
+		parms.TagFilter = policy.FilterTags
+	}
+	target, err := dao.GetRepTarget(policy.TargetID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get target, error: %v", err)
+	}
+	if target == nil {
+		return nil, fmt.Errorf("The target doesn't exist in DB, target id: %d", policy.TargetID)
+	}
+	pwd, transport, err := utils.TargetCredential(target)
+	if err != nil {
+		return nil, err
+	}
+	parms.TargetID = target.ID
+	parms.TargetURL = target.URL
+	parms.TargetUsername = target.Username
+	parms.TargetPassword = pwd
+	parms.TargetType = target.Type
+	parms.BandwidthLimit = target.BandwidthLimit
+	parms.TargetInsecure = target.Insecure
+	parms.TargetCACert = transport.CACert
+	parms.TargetClientCert = transport.ClientCert
+	parms.TargetClientKey = transport.ClientKey
+	parms.TargetProxyURL = transport.ProxyURL
+	parms.TargetProxyUsername = transport.ProxyUsername
+	parms.TargetProxyPassword = transport.ProxyPassword
+	parms.TargetNoProxy = transport.NoProxy
+	parms.TargetUpdateTime = transport.UpdateTime
+	return parms, nil
+}
+
+// targetTransport returns the TLS and proxy settings to connect to the target, the
+// certificate of the target is not verified if either the target or the global setting says so
+func (p *RepJobParm) targetTransport() *registry.TransportConfig {
+	return &registry.TransportConfig{
+		Insecure:      p.Insecure || p.TargetInsecure,
+		CACert:        p.TargetCACert,
+		ClientCert:    p.TargetClientCert,
+		ClientKey:     p.TargetClientKey,
+		ProxyURL:      p.TargetProxyURL,
+		ProxyUsername: p.TargetProxyUsername,
+		ProxyPassword: p.TargetProxyPassword,
+		NoProxy:       p.TargetNoProxy,
+		TargetID:      p.TargetID,
+		UpdateTime:    p.TargetUpdateTime,
+	}
+}
+
+// Labels returns the label values of the metrics of the job
+func (p *RepJobParm) Labels() (string, string, string) {
+	return strconv.FormatInt(p.PolicyID, 10), strconv.FormatInt(p.TargetID, 10), p.Operation
+}
+
+// DiffRepository compares the tags of the repository on the source registry of the
+// policy with the ones on the destination registry.
+func DiffRepository(policy *models.RepPolicy, repository string) (*models.RepDiff, error) {
+	parms, err := newRepJobParm(policy, &models.RepJob{
+		PolicyID:   policy.ID,
+		Repository: repository,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger := log.New(os.Stdout, log.NewTextFormatter(), log.WarningLevel)
+	base := newBaseHandler(parms, policy.Direction == models.RepDirectionPull,
+		replication.NewProgress(), logger)
+	return base.Diff()
+}
+
+func addImgTransferTransition(sm *SM) error {
+	parms := sm.Parms.(*RepJobParm)
+	progress := replication.NewProgress()
+	sm.Progress = progress
+	base := newBaseHandler(parms, false, progress, sm.Logger)
+	setDigest(base, parms, sm.JobID)
+	setUpload(base, parms)
+	addTransferTransitions(sm, base)
+	return nil
+}
+
+func addImgPullTransition(sm *SM) error {
+	parms := sm.Parms.(*RepJobParm)
+	progress := replication.NewProgress()
+	sm.Progress = progress
+	base := newBaseHandler(parms, true, progress, sm.Logger)
+	setDigest(base, parms, sm.JobID)
+	setUpload(base, parms)
+	addTransferTransitions(sm, base)
+	return nil
+}
+
+// newBaseHandler returns the handler which replicates the repository from local to the
+// target, or from the target to local if pull is true.
+func newBaseHandler(parms *RepJobParm, pull bool, progress *replication.Progress,
+	logger *log.Logger) *replication.BaseHandler {
+	var base *replication.BaseHandler
+	if pull {
+		base = replication.InitPullHandler(parms.Repository, parms.LocalRegURL, config.UISecret(),
+			parms.TargetURL, parms.TargetUsername, parms.TargetPassword,
+			parms.Insecure, parms.Tags, progress, logger)
+	} else {
+		base = replication.InitBaseHandler(parms.Repository, parms.LocalRegURL, config.UISecret(),
+			parms.TargetURL, parms.TargetUsername, parms.TargetPassword, parms.TargetType,
+			parms.Insecure, parms.Tags, progress, logger)
+		base.SetBlobIndex(parms.TargetID)
+	}
+	base.SetTargetTransport(parms.targetTransport())
+	base.SetTagFilter(parms.TagFilter)
+	return base
+}
+
+// setDigest pins the tag of the job to the digest the job carries, and records the
+// digest replicated on the job, if the job replicates a single tag.
+func setDigest(base *replication.BaseHandler, parms *RepJobParm, jobID int64) {
+	if len(parms.Tags) != 1 {
+		return
+	}
+	if len(parms.Digest) != 0 {
+		base.PinDigest(parms.Digest)
+	}
+	base.RecordDigest(jobID)
+}
+
+// setUpload sets how the blobs are pushed, the upload left by the previous attempt
+// of the job is resumed if there is one.
+func setUpload(base *replication.BaseHandler, parms *RepJobParm) {
+	base.SetChunkSize(config.BlobChunkSize())
+	base.SetConcurrency(config.BlobTransferConcurrency(), config.TargetMaxTransfers())
+	base.SetBandwidthLimit(parms.BandwidthLimit * 1024)
+	if p := parms.Progress; p != nil && len(p.Uploads) != 0 {
+		base.ResumeUploads(p.Uploads)
+	}
+}
+
+// addTransferTransitions adds the transitions which transfer the images from the
+// source registry to the destination registry of base
+func addTransferTransitions(sm *SM, base *replication.BaseHandler) {
+	base.SetCancel(sm.Canceled())
+	sm.AddTransition(models.JobRunning, replication.StateInitialize, &replication.Initializer{BaseHandler: base})
+	sm.AddTransition(replication.StateInitialize, replication.StateCheck, &replication.Checker{BaseHandler: base})
+	sm.AddTransition(replication.StateCheck, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
+	sm.AddTransition(replication.StatePullManifest, replication.StateTransferBlob, &replication.BlobTransfer{BaseHandler: base})
+	sm.AddTransition(replication.StateTransferBlob, replication.StateTransferBlob, &replication.BlobTransfer{BaseHandler: base})
+	sm.AddTransition(replication.StatePullManifest, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
+	sm.AddTransition(replication.StateTransferBlob, replication.StatePushManifest, &replication.ManifestPusher{BaseHandler: base})
+	sm.AddTransition(replication.StatePushManifest, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
+}
+
+func addImgDeleteTransition(sm *SM) error {
+	parms := sm.Parms.(*RepJobParm)
+	deleter := replication.NewDeleter(parms.Repository, parms.Tags, parms.TargetURL,
+		parms.TargetUsername, parms.TargetPassword, parms.TargetType, parms.targetTransport(), sm.Logger)
+	deleter.SetTagFilter(parms.TagFilter)
+
+	sm.AddTransition(models.JobRunning, replication.StateDelete, deleter)
+	sm.AddTransition(replication.StateDelete, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
+	return nil
+}
@@ -16,21 +16,187 @@
 package job
 
 import (
-	"github.com/vmware/harbor/src/common/utils/log"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
 )
 
-var jobQueue = make(chan int64)
+const (
+	// the duration for which a claimed job is leased to the job service
+	leaseDuration = 2 * time.Minute
+	// the interval at which the lease of a running job is renewed
+	heartbeatInterval = 30 * time.Second
+	// the interval at which the job queue is polled when no job is scheduled
+	pollInterval = 10 * time.Second
+	// the count of health check intervals after which the result of the health
+	// check of a target is too old to hold its jobs
+	staleHealthChecks = 3
+)
+
+// jobQueue notifies the dispatcher that there are jobs waiting in DB
+var jobQueue = make(chan struct{}, 1)
+
+// held caches the IDs of the policies whose jobs are held, it is refreshed once per
+// pollInterval rather than on every claim
+var held = struct {
+	sync.Mutex
+	ids       []int64
+	refreshed time.Time
+}{}
+
+var owner string
 
-// Schedule put a job id into job queue.
+func init() {
+	hostname, err := os.Hostname()
+	if err != nil || len(hostname) == 0 {
+		log.Warningf("Failed to get hostname, error: %v, jobservice will be used as the lease owner", err)
+		hostname = "jobservice"
+	}
+	owner = hostname
+}
+
+// Owner returns the name this job service instance uses to lease jobs.
+func Owner() string {
+	return owner
+}
+
+// Schedule notifies the dispatcher that a job has been put into the job queue, the
+// job queue is persisted in DB so the job will not be lost if the job service restarts.
 func Schedule(jobID int64) {
-	jobQueue <- jobID
+	log.Debugf("Job %d is scheduled", jobID)
+	notify()
+}
+
+func notify() {
+	select {
+	case jobQueue <- struct{}{}:
+	default:
+		// the dispatcher has been notified already
+	}
+}
+
+// nextJob blocks until a job is claimed from the job queue, it returns 0 if
+// the job service is draining.
+func nextJob() int64 {
+	for {
+		if isDraining() {
+			return 0
+		}
+		now := time.Now()
+		ids, err := heldPolicies(now)
+		if err != nil {
+			log.Errorf("Failed to get the policies whose jobs are held, error: %v", err)
+		} else if id, err := dao.ClaimRepJob(owner, now.Add(leaseDuration), now, ids...); err != nil {
+			log.Errorf("Failed to claim job from the job queue, error: %v", err)
+		} else if id != 0 {
+			return id
+		}
+		select {
+		case <-jobQueue:
+		case <-time.After(pollInterval):
+		case <-draining:
+		}
+	}
+}
+
+// heldPolicies returns the IDs of the policies whose jobs stay in the job queue at now,
+// either because their time windows are closed or their targets are unreachable. The
+// IDs are cached for pollInterval, when they are refreshed the running jobs of the
+// policies whose windows have closed are drained back to the job queue.
+func heldPolicies(now time.Time) ([]int64, error) {
+	held.Lock()
+	defer held.Unlock()
+	if !held.refreshed.IsZero() && now.Sub(held.refreshed) < pollInterval {
+		return held.ids, nil
+	}
+
+	closed, err := closedPolicies(now)
+	if err != nil {
+		return nil, err
+	}
+	unreachable, err := unreachablePolicies(now)
+	if err != nil {
+		return nil, err
+	}
+	held.ids = append(closed, unreachable...)
+	held.refreshed = now
+
+	if WorkerPool != nil {
+		WorkerPool.drainPolicies(closed)
+	}
+	return held.ids, nil
+}
+
+// refreshHeldPolicies refreshes the held policies periodically, so the running jobs of
+// the policies whose windows have closed are drained even if no job is being claimed.
+func refreshHeldPolicies() {
+	for {
+		if _, err := heldPolicies(time.Now()); err != nil {
+			log.Errorf("Failed to get the policies whose jobs are held, error: %v", err)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// unreachablePolicies returns the IDs of the policies whose targets were unreachable at
+// their latest health checks, their jobs are claimed once the targets are reachable again
+// instead of burning retries. The stale results are ignored so the jobs are not held
+// forever if the health check stops.
+func unreachablePolicies(now time.Time) ([]int64, error) {
+	interval := config.TargetHealthCheckInterval()
+	if interval == 0 {
+		return nil, nil
+	}
+	return dao.GetUnreachableRepPolicyIDs(now.Add(-staleHealthChecks * interval))
+}
+
+// closedPolicies returns the IDs of the policies whose time windows are all closed at now,
+// their jobs stay in the job queue and are claimed when one of the windows opens.
+func closedPolicies(now time.Time) ([]int64, error) {
+	policies, err := dao.GetWindowedRepPolicies()
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	for _, policy := range policies {
+		if !policy.InWindow(now) {
+			ids = append(ids, policy.ID)
+		}
+	}
+	return ids, nil
+}
+
+// heartbeat renews the lease of a job periodically until done is closed.
+func heartbeat(jobID int64, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := dao.RenewRepJobLease(jobID, owner, time.Now().Add(leaseDuration)); err != nil {
+				log.Warningf("Failed to renew the lease of job: %d, error: %v", jobID, err)
+			}
+		case <-done:
+			return
+		}
+	}
 }
 
-// Reschedule is called by statemachine to retry a job
-func Reschedule(jobID int64) {
-	log.Debugf("Job %d will be rescheduled in 5 minutes", jobID)
-	time.Sleep(5 * time.Minute)
-	log.Debugf("Rescheduling job %d", jobID)
-	Schedule(jobID)
+// releaseExpiredJobs puts the jobs whose lease has expired back to the job queue,
+// the holder of these jobs is considered to be dead.
+func releaseExpiredJobs() {
+	for {
+		n, err := dao.ReleaseExpiredRepJobs(time.Now())
+		if err != nil {
+			log.Errorf("Failed to release jobs whose lease has expired, error: %v", err)
+		} else if n > 0 {
+			log.Infof("%d jobs whose lease has expired have been put back to the job queue", n)
+			notify()
+		}
+		time.Sleep(leaseDuration)
+	}
 }
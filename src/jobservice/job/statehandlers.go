@@ -21,6 +21,7 @@ import (
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
 )
 
 // StateHandler handles transition, it associates with each state, will be called when
@@ -59,24 +60,101 @@ func (su StatusUpdater) Exit() error {
 	return nil
 }
 
-// Retry handles a special "retrying" in which case it will update the status in DB and reschedule the job
-// via scheduler
+// Retry handles a special "retrying" in which case it will record the failed attempt and update
+// the status in DB, the job will be claimed from the job queue again after an exponential backoff.
+// If the retries are exhausted, it returns "error" to make the job fail.
 type Retry struct {
 	JobID int64
+	// Attempt is the sequence number of the current attempt of the job, starting from 1
+	Attempt int
+	// Err is the error which caused the current attempt to fail
+	Err    error
+	Logger *log.Logger
 }
 
 // Enter ...
-func (jr Retry) Enter() (string, error) {
-	err := dao.UpdateRepJobStatus(jr.JobID, models.JobRetrying)
+func (jr *Retry) Enter() (string, error) {
+	recordAttempt(jr.JobID, jr.Attempt, jr.Err)
+	if jr.Attempt > config.MaxJobRetries() {
+		if err := dao.UpdateRepJobRetryCount(jr.JobID, jr.Attempt); err != nil {
+			log.Errorf("Failed to update retry count of job :%d, error: %v", jr.JobID, err)
+		}
+		jr.Logger.Errorf("the job has failed %d times, retries are exhausted", jr.Attempt)
+		return models.JobError, nil
+	}
+
+	next := time.Now().Add(retryBackoff(jr.Attempt, config.JobRetryInterval(),
+		config.JobRetryMaxInterval(), config.JobRetryMultiplier()))
+	err := dao.UpdateRepJobRetry(jr.JobID, jr.Attempt, next)
 	if err != nil {
 		log.Errorf("Failed to update state of job :%d to Retrying, error: %v", jr.JobID, err)
+		return "", err
+	}
+	jr.Logger.Infof("the job will be retried after %s", next.Format(time.RFC3339))
+	return "", nil
+}
+
+// Exit ...
+func (jr *Retry) Exit() error {
+	return nil
+}
+
+// retryBackoff returns the interval to wait before the next attempt of a job whose
+// attempt failed, the interval grows exponentially but never exceeds max.
+func retryBackoff(attempt int, base, max time.Duration, multiplier float64) time.Duration {
+	d := float64(base)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// recordAttempt persists the failed attempt of a job so it is visible in the job history
+func recordAttempt(jobID int64, attempt int, err error) {
+	a := models.RepJobAttempt{
+		JobID:   jobID,
+		Attempt: attempt,
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if _, e := dao.AddRepJobAttempt(a); e != nil {
+		log.Errorf("Failed to record attempt %d of job: %d, error: %v", attempt, jobID, e)
+	}
+}
+
+// Releaser handles the "pending" state which the state machine enters when the job is drained,
+// it puts the job back to the job queue so the job will be resumed later.
+type Releaser struct {
+	JobID  int64
+	Logger *log.Logger
+	// Reason returns why the job is drained, it may be nil
+	Reason func() string
+}
+
+// Enter ...
+func (r Releaser) Enter() (string, error) {
+	if err := dao.ReleaseRepJob(r.JobID, owner); err != nil {
+		log.Errorf("Failed to put job: %d back to the job queue, error: %v", r.JobID, err)
+		return "", err
+	}
+	reason := ""
+	if r.Reason != nil {
+		reason = r.Reason()
+	}
+	if len(reason) == 0 {
+		r.Logger.Info("the job is put back to the job queue and will be resumed later")
+		return "", nil
 	}
-	go Reschedule(jr.JobID)
-	return "", err
+	r.Logger.Infof("%s, the job is put back to the job queue and will be resumed later", reason)
+	return "", nil
 }
 
 // Exit ...
-func (jr Retry) Exit() error {
+func (r Releaser) Exit() error {
 	return nil
 }
 
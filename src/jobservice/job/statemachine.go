@@ -18,29 +18,15 @@ package job
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
-	"github.com/vmware/harbor/src/jobservice/config"
-	"github.com/vmware/harbor/src/jobservice/replication"
+	"github.com/vmware/harbor/src/jobservice/metrics"
 	"github.com/vmware/harbor/src/jobservice/utils"
 	"github.com/vmware/harbor/src/common/models"
-	uti "github.com/vmware/harbor/src/common/utils"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
-// RepJobParm wraps the parm of a job
-type RepJobParm struct {
-	LocalRegURL    string
-	TargetURL      string
-	TargetUsername string
-	TargetPassword string
-	Repository     string
-	Tags           []string
-	Enabled        int
-	Operation      string
-	Insecure       bool
-}
-
 // SM is the state machine to handle job, it handles one job at a time.
 type SM struct {
 	JobID         int64
@@ -52,10 +38,29 @@ type SM struct {
 	Handlers     map[string]StateHandler
 	desiredState string
 	Logger       *log.Logger
-	Parms        *RepJobParm
-	lock         *sync.Mutex
+	// Parms holds the parameters of the current job loaded by its job type
+	Parms interface{}
+	// Progress tracks the progress of the current job, it is nil if the job does not report progress
+	Progress ProgressReporter
+	lock     *sync.Mutex
+	retry    *Retry
+	// labels holds the values of labels "policy_id", "target_id" and "operation" of the current job
+	labels []string
+	// canceled is closed when the current job is stopped or drained
+	canceled chan struct{}
+	// drainReason is why the current job is drained, it is logged when the job is put back
+	// to the job queue
+	drainReason string
+}
+
+// ProgressReporter reports the progress of a job
+type ProgressReporter interface {
+	Snapshot() *models.RepJobProgress
 }
 
+// the interval at which the progress of a running job is persisted
+const progressInterval = 10 * time.Second
+
 // EnterState transit the statemachine from the current state to the state in parameter.
 // It returns the next state the statemachine should tranit to.
 func (sm *SM) EnterState(s string) (string, error) {
@@ -78,7 +83,10 @@ func (sm *SM) EnterState(s string) (string, error) {
 	var next = models.JobContinue
 	var err error
 	if ok {
-		if next, err = enterHandler.Enter(); err != nil {
+		start := time.Now()
+		next, err = enterHandler.Enter()
+		metrics.StateDuration.Observe(time.Since(start).Seconds(), sm.metricLabels(s)...)
+		if err != nil {
 			return "", err
 		}
 	} else {
@@ -119,6 +127,18 @@ func (sm *SM) Start(s string) {
 		log.Debugf("Job id: %d, next state from handler: %s", sm.JobID, n)
 	}
 	if err != nil {
+		if e, ok := err.(RetryableError); ok && e.Retryable() && sm.retry != nil {
+			log.Warningf("Job id: %d, the statemachine will enter retrying state due to error: %v", sm.JobID, e)
+			sm.retry.Err = e
+			if n, err = sm.EnterState(models.JobRetrying); err == nil {
+				if len(n) > 0 {
+					sm.EnterState(n)
+				}
+				return
+			}
+		} else if sm.retry != nil {
+			recordAttempt(sm.JobID, sm.retry.Attempt, err)
+		}
 		log.Warningf("Job id: %d, the statemachin will enter error state due to error: %v", sm.JobID, err)
 		sm.EnterState(models.JobError)
 	}
@@ -153,17 +173,105 @@ func (sm *SM) Stop(id int64) {
 	if id == sm.JobID {
 		sm.desiredState = models.JobStopped
 		log.Debugf("Desired state of job %d is set to stopped", id)
+		sm.cancel()
 	} else {
 		log.Debugf("State machine has switched to job %d, so the action to stop job %d will be ignored", sm.JobID, id)
 	}
 }
 
+// reportProgress persists the progress of a job periodically until done is closed,
+// the progress is persisted once more before it returns. The bytes transferred since
+// last report are added to the metrics with the labels.
+func reportProgress(jobID int64, progress ProgressReporter, labels []string, done <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	var transferred int64
+	for {
+		stop := false
+		select {
+		case <-ticker.C:
+		case <-done:
+			stop = true
+		}
+		snapshot := progress.Snapshot()
+		metrics.BytesTransferred.Add(float64(snapshot.BytesTransferred-transferred), labels...)
+		transferred = snapshot.BytesTransferred
+		if err := dao.UpdateRepJobProgress(jobID, snapshot); err != nil {
+			log.Warningf("Failed to update the progress of job: %d, error: %v", jobID, err)
+		}
+		if stop {
+			return
+		}
+	}
+}
+
+// Drain sets the desired state as "pending" such that when next transition happens the state machine
+// will put the current job back to the job queue, unless the job is being stopped.
+func (sm *SM) Drain() {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if len(sm.desiredState) == 0 {
+		sm.desiredState = models.JobPending
+		sm.drainReason = "the job service is shutting down"
+		log.Debugf("Desired state of job %d is set to pending", sm.JobID)
+		sm.cancel()
+	}
+}
+
+// drainPolicy drains the current job if it belongs to the policy whose ID is policyID,
+// it returns whether the job is drained.
+func (sm *SM) drainPolicy(policyID string) bool {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if len(sm.labels) == 0 || sm.labels[0] != policyID || len(sm.desiredState) != 0 {
+		return false
+	}
+	sm.desiredState = models.JobPending
+	sm.drainReason = "the time window of the policy has closed"
+	log.Debugf("Desired state of job %d is set to pending", sm.JobID)
+	sm.cancel()
+	return true
+}
+
+// Canceled returns the channel which is closed when the current job is stopped or drained,
+// so the handlers blocking on something else than the transitions can give up early.
+func (sm *SM) Canceled() <-chan struct{} {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.canceled
+}
+
+// cancel closes the channel returned by Canceled, the caller must hold the lock
+func (sm *SM) cancel() {
+	if sm.canceled == nil {
+		return
+	}
+	select {
+	case <-sm.canceled:
+	default:
+		close(sm.canceled)
+	}
+}
+
+// metricLabels returns the label values of the current job followed by the extra ones
+func (sm *SM) metricLabels(extra ...string) []string {
+	labels := make([]string, 3, 3+len(extra))
+	copy(labels, sm.labels)
+	return append(labels, extra...)
+}
+
 func (sm *SM) getDesiredState() string {
 	sm.lock.Lock()
 	defer sm.lock.Unlock()
 	return sm.desiredState
 }
 
+func (sm *SM) getDrainReason() string {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.drainReason
+}
+
 func (sm *SM) setDesiredState(s string) {
 	sm.lock.Lock()
 	defer sm.lock.Unlock()
@@ -180,6 +288,7 @@ func (sm *SM) Init() {
 		models.JobStopped:  struct{}{},
 		models.JobCanceled: struct{}{},
 		models.JobRetrying: struct{}{},
+		models.JobPending:  struct{}{},
 	}
 }
 
@@ -189,7 +298,12 @@ func (sm *SM) Reset(jid int64) error {
 	sm.lock.Lock()
 	sm.JobID = jid
 	sm.desiredState = ""
+	sm.drainReason = ""
+	sm.labels = nil
+	sm.canceled = make(chan struct{})
 	sm.lock.Unlock()
+	sm.retry = nil
+	sm.Progress = nil
 
 	sm.Logger = utils.NewLogger(sm.JobID)
 	//init parms
@@ -200,44 +314,23 @@ func (sm *SM) Reset(jid int64) error {
 	if job == nil {
 		return fmt.Errorf("The job doesn't exist in DB, job id: %d", sm.JobID)
 	}
-	policy, err := dao.GetRepPolicy(job.PolicyID)
-	if err != nil {
-		return fmt.Errorf("Failed to get policy, error: %v", err)
-	}
-	if policy == nil {
-		return fmt.Errorf("The policy doesn't exist in DB, policy id:%d", job.PolicyID)
-	}
-	sm.Parms = &RepJobParm{
-		LocalRegURL: config.LocalRegURL(),
-		Repository:  job.Repository,
-		Tags:        job.TagList,
-		Enabled:     policy.Enabled,
-		Operation:   job.Operation,
-		Insecure:    !config.VerifyRemoteCert(),
-	}
-	if policy.Enabled == 0 {
-		//worker will cancel this job
-		return nil
+	jobType, ok := jobTypes[job.Kind]
+	if !ok {
+		return fmt.Errorf("unsupported kind of job: %s", job.Kind)
 	}
-	target, err := dao.GetRepTarget(policy.TargetID)
+	sm.Parms, err = jobType.LoadParms(job)
 	if err != nil {
-		return fmt.Errorf("Failed to get target, error: %v", err)
+		return err
 	}
-	if target == nil {
-		return fmt.Errorf("The target doesn't exist in DB, target id: %d", policy.TargetID)
+	labels := []string{"", "", job.Kind}
+	if l, ok := sm.Parms.(Labeled); ok {
+		policyID, targetID, op := l.Labels()
+		labels = []string{policyID, targetID, op}
 	}
-	sm.Parms.TargetURL = target.URL
-	sm.Parms.TargetUsername = target.Username
-	pwd := target.Password
-
-	if len(pwd) != 0 {
-		pwd, err = uti.ReversibleDecrypt(pwd, config.SecretKey())
-		if err != nil {
-			return fmt.Errorf("failed to decrypt password: %v", err)
-		}
-	}
-
-	sm.Parms.TargetPassword = pwd
+	// the labels are read by drainPolicy from other goroutines
+	sm.lock.Lock()
+	sm.labels = labels
+	sm.lock.Unlock()
 
 	//init states handlers
 	sm.Handlers = make(map[string]StateHandler)
@@ -248,44 +341,19 @@ func (sm *SM) Reset(jid int64) error {
 	sm.AddTransition(models.JobRetrying, models.JobRunning, StatusUpdater{sm.JobID, models.JobRunning})
 	sm.Handlers[models.JobError] = StatusUpdater{sm.JobID, models.JobError}
 	sm.Handlers[models.JobStopped] = StatusUpdater{sm.JobID, models.JobStopped}
-	sm.Handlers[models.JobRetrying] = Retry{sm.JobID}
-
-	switch sm.Parms.Operation {
-	case models.RepOpTransfer:
-		addImgTransferTransition(sm)
-	case models.RepOpDelete:
-		addImgDeleteTransition(sm)
-	default:
-		err = fmt.Errorf("unsupported operation: %s", sm.Parms.Operation)
+	sm.Handlers[models.JobPending] = Releaser{sm.JobID, sm.Logger, sm.getDrainReason}
+	sm.retry = &Retry{
+		JobID:   sm.JobID,
+		Attempt: job.RetryCount + 1,
+		Logger:  sm.Logger,
 	}
+	sm.Handlers[models.JobRetrying] = sm.retry
 
-	return err
+	return jobType.AddTransitions(sm)
 }
 
 //for testing onlly
 func addTestTransition(sm *SM) error {
-	sm.AddTransition(models.JobRunning, "pull-img", ImgPuller{img: sm.Parms.Repository, logger: sm.Logger})
+	sm.AddTransition(models.JobRunning, "pull-img", ImgPuller{img: sm.Parms.(*RepJobParm).Repository, logger: sm.Logger})
 	return nil
 }
-
-func addImgTransferTransition(sm *SM) {
-	base := replication.InitBaseHandler(sm.Parms.Repository, sm.Parms.LocalRegURL, config.UISecret(),
-		sm.Parms.TargetURL, sm.Parms.TargetUsername, sm.Parms.TargetPassword,
-		sm.Parms.Insecure, sm.Parms.Tags, sm.Logger)
-
-	sm.AddTransition(models.JobRunning, replication.StateInitialize, &replication.Initializer{BaseHandler: base})
-	sm.AddTransition(replication.StateInitialize, replication.StateCheck, &replication.Checker{BaseHandler: base})
-	sm.AddTransition(replication.StateCheck, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
-	sm.AddTransition(replication.StatePullManifest, replication.StateTransferBlob, &replication.BlobTransfer{BaseHandler: base})
-	sm.AddTransition(replication.StatePullManifest, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
-	sm.AddTransition(replication.StateTransferBlob, replication.StatePushManifest, &replication.ManifestPusher{BaseHandler: base})
-	sm.AddTransition(replication.StatePushManifest, replication.StatePullManifest, &replication.ManifestPuller{BaseHandler: base})
-}
-
-func addImgDeleteTransition(sm *SM) {
-	deleter := replication.NewDeleter(sm.Parms.Repository, sm.Parms.Tags, sm.Parms.TargetURL,
-		sm.Parms.TargetUsername, sm.Parms.TargetPassword, sm.Parms.Insecure, sm.Logger)
-
-	sm.AddTransition(models.JobRunning, replication.StateDelete, deleter)
-	sm.AddTransition(replication.StateDelete, models.JobFinished, &StatusUpdater{sm.JobID, models.JobFinished})
-}
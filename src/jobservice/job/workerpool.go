@@ -16,8 +16,14 @@
 package job
 
 import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/metrics"
 	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
@@ -27,6 +33,16 @@ type workerPool struct {
 	workerList []*Worker
 }
 
+// the interval at which the running jobs are checked when draining
+const drainPollInterval = 500 * time.Millisecond
+
+// draining is closed when the job service starts draining
+var draining = make(chan struct{})
+var drainOnce sync.Once
+
+// the count of jobs being handled by workers
+var runningJobs int32
+
 // WorkerPool is a set of workers each worker is associate to a statemachine for handling jobs.
 // it consists of a channel for free workers and a list to all workers
 var WorkerPool *workerPool
@@ -35,10 +51,32 @@ var WorkerPool *workerPool
 func (wp *workerPool) StopJobs(jobs []int64) {
 	log.Debugf("Works working on jobs: %v will be stopped", jobs)
 	for _, id := range jobs {
+		wp.StopJob(id)
+	}
+}
+
+// StopJob tries to stop the job if it is being executed by a worker, it returns false if
+// no worker is working on the job.
+func (wp *workerPool) StopJob(id int64) bool {
+	found := false
+	for _, w := range wp.workerList {
+		if w.SM.JobID == id {
+			log.Debugf("found a worker whose job ID is %d, will try to stop it", id)
+			w.SM.Stop(id)
+			found = true
+		}
+	}
+	return found
+}
+
+// drainPolicies puts the running jobs of the policies back to the job queue when next
+// transition happens.
+func (wp *workerPool) drainPolicies(policies []int64) {
+	for _, id := range policies {
+		policyID := strconv.FormatInt(id, 10)
 		for _, w := range wp.workerList {
-			if w.SM.JobID == id {
-				log.Debugf("found a worker whose job ID is %d, will try to stop it", id)
-				w.SM.Stop(id)
+			if w.SM.drainPolicy(policyID) {
+				log.Infof("The window of policy %d has closed, the job being handled by worker %d will be put back to the job queue", id, w.ID)
 			}
 		}
 	}
@@ -80,7 +118,20 @@ func (w *Worker) Stop() {
 }
 
 func (w *Worker) handleRepJob(id int64) {
+	atomic.AddInt32(&runningJobs, 1)
+	defer atomic.AddInt32(&runningJobs, -1)
+
+	done := make(chan struct{})
+	defer close(done)
+	go heartbeat(id, done)
+
 	err := w.SM.Reset(id)
+	if err == ErrCanceled {
+		log.Debugf("The job:%d is canceled by its job type", id)
+		_ = dao.UpdateRepJobStatus(id, models.JobCanceled)
+		w.SM.Logger.Info("The job has been canceled")
+		return
+	}
 	if err != nil {
 		log.Errorf("Worker %d, failed to re-initialize statemachine for job: %d, error: %v", w.ID, id, err)
 		err2 := dao.UpdateRepJobStatus(id, models.JobError)
@@ -89,15 +140,26 @@ func (w *Worker) handleRepJob(id int64) {
 		}
 		return
 	}
-	if w.SM.Parms.Enabled == 0 {
-		log.Debugf("The policy of job:%d is disabled, will cancel the job", id)
-		_ = dao.UpdateRepJobStatus(id, models.JobCanceled)
-		w.SM.Logger.Info("The job has been canceled")
-	} else {
-		w.SM.Start(models.JobRunning)
+	if isDraining() {
+		w.SM.Drain()
+	}
+	if w.SM.Progress != nil {
+		progressDone := make(chan struct{})
+		defer close(progressDone)
+		go reportProgress(id, w.SM.Progress, w.SM.metricLabels(), progressDone)
+	}
+	w.SM.Start(models.JobRunning)
+	metrics.Runs.Inc(w.SM.metricLabels(w.SM.CurrentState)...)
+	if w.SM.CurrentState == models.JobRetrying {
+		metrics.Retries.Inc(w.SM.metricLabels()...)
 	}
 }
 
+// BusyWorkers returns the count of workers which are handling jobs
+func BusyWorkers() int {
+	return int(atomic.LoadInt32(&runningJobs))
+}
+
 // NewWorker returns a pointer to new instance of worker
 func NewWorker(id int) *Worker {
 	w := &Worker{
@@ -124,16 +186,56 @@ func InitWorkerPool() {
 	}
 }
 
-// Dispatch will listen to the jobQueue of job service and try to pick a free worker from the worker pool and assign the job to it.
+// Dispatch will wait for a free worker from the worker pool, claim a job from the job queue in DB and assign the job to it.
+// It returns when the job service starts draining.
 func Dispatch() {
+	go releaseExpiredJobs()
+	go refreshHeldPolicies()
 	for {
-		select {
-		case job := <-jobQueue:
-			go func(jobID int64) {
-				log.Debugf("Trying to dispatch job: %d", jobID)
-				worker := <-WorkerPool.workerChan
-				worker.RepJobs <- jobID
-			}(job)
+		worker := <-WorkerPool.workerChan
+		jobID := nextJob()
+		if jobID == 0 {
+			log.Debugf("The job service is draining, stop dispatching jobs")
+			return
 		}
+		log.Debugf("Dispatching job: %d to worker: %d", jobID, worker.ID)
+		worker.RepJobs <- jobID
+	}
+}
+
+// Drain stops dispatching jobs and asks the workers to put their jobs back to the job queue
+// when next transition happens, i.e. after the current step such as transferring a blob or
+// pushing a manifest completes. It waits until all workers are idle or the timeout expires,
+// the jobs which are still running then are put back to the job queue as well.
+func Drain(timeout time.Duration) {
+	drainOnce.Do(func() {
+		close(draining)
+	})
+	for _, w := range WorkerPool.workerList {
+		w.SM.Drain()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt32(&runningJobs) > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	if n := atomic.LoadInt32(&runningJobs); n > 0 {
+		log.Warningf("%d jobs are still running after %v, they will be put back to the job queue", n, timeout)
+	}
+
+	n, err := dao.ReleaseRepJobsByOwner(owner)
+	if err != nil {
+		log.Errorf("Failed to put running jobs back to the job queue, error: %v", err)
+		return
+	}
+	log.Infof("Job service drained, %d running jobs have been put back to the job queue", n)
+}
+
+func isDraining() bool {
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
 	}
 }
@@ -16,10 +16,17 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/astaxie/beego"
 	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/health"
 	"github.com/vmware/harbor/src/jobservice/job"
-	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/jobservice/retention"
+	"github.com/vmware/harbor/src/jobservice/scheduler"
 	"github.com/vmware/harbor/src/common/utils/log"
 )
 
@@ -27,24 +34,35 @@ func main() {
 	dao.InitDatabase()
 	initRouters()
 	job.InitWorkerPool()
-	go job.Dispatch()
 	resumeJobs()
+	go job.Dispatch()
+	scheduler.DefaultScheduler.Start()
+	retention.Start()
+	health.Start()
+	go drainOnSignal()
 	beego.Run()
 }
 
+// drainOnSignal drains the jobs and exits when SIGTERM or SIGINT is received, so
+// the running jobs can be resumed after the job service restarts.
+func drainOnSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	log.Infof("Signal %v received, draining jobs...", sig)
+	job.Drain(config.JobDrainTimeout())
+	os.Exit(0)
+}
+
+// resumeJobs puts the jobs which were running on this instance before it
+// halted back to the job queue, the pending and retrying jobs are kept in
+// the job queue and will be dispatched again once the dispatcher starts.
 func resumeJobs() {
 	log.Debugf("Trying to resume halted jobs...")
-	err := dao.ResetRunningJobs()
+	n, err := dao.ReleaseRepJobsByOwner(job.Owner())
 	if err != nil {
-		log.Warningf("Failed to reset all running jobs to pending, error: %v", err)
-	}
-	jobs, err := dao.GetRepJobByStatus(models.JobPending, models.JobRetrying)
-	if err == nil {
-		for _, j := range jobs {
-			log.Debugf("Resuming job: %d", j.ID)
-			job.Schedule(j.ID)
-		}
-	} else {
-		log.Warningf("Failed to jobs to resume, error: %v", err)
+		log.Warningf("Failed to reset running jobs to pending, error: %v", err)
+		return
 	}
+	log.Debugf("%d running jobs have been reset to pending", n)
 }
@@ -0,0 +1,233 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package metrics collects the metrics of job service and exposes them in
+// Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+	typeSummary = "summary"
+)
+
+var (
+	// QueueDepth is the count of jobs waiting in the job queue
+	QueueDepth = newVec("harbor_jobservice_queue_depth", typeGauge,
+		"The count of jobs waiting in the job queue.", "policy_id", "target_id", "operation", "status")
+	// Workers is the count of workers in the worker pool
+	Workers = newVec("harbor_jobservice_workers", typeGauge,
+		"The count of workers in the worker pool.", "state")
+	// StateDuration is the time spent by the state handlers of jobs
+	StateDuration = newVec("harbor_jobservice_job_state_duration_seconds", typeSummary,
+		"The time spent by the state handlers of jobs.", "policy_id", "target_id", "operation", "state")
+	// Runs is the count of job runs by the status in which they ended
+	Runs = newVec("harbor_jobservice_job_runs_total", typeCounter,
+		"The count of job runs by the status in which they ended.", "policy_id", "target_id", "operation", "status")
+	// Retries is the count of retries of jobs
+	Retries = newVec("harbor_jobservice_job_retries_total", typeCounter,
+		"The count of retries of jobs.", "policy_id", "target_id", "operation")
+	// BytesTransferred is the size of data transferred by jobs
+	BytesTransferred = newVec("harbor_jobservice_transferred_bytes_total", typeCounter,
+		"The size in bytes of data transferred by jobs.", "policy_id", "target_id", "operation")
+	// Coalesced is the count of jobs merged into pending jobs instead of being queued
+	Coalesced = newVec("harbor_jobservice_jobs_coalesced_total", typeCounter,
+		"The count of jobs merged into pending jobs of the same policy, repository and operation.", "policy_id", "operation")
+	// TargetUp is whether the target was reachable at the latest health check
+	TargetUp = newVec("harbor_jobservice_target_up", typeGauge,
+		"Whether the target was reachable at the latest health check, 1 means reachable.", "target_id")
+	// TargetLatency is the time the target took to respond to the latest health check
+	TargetLatency = newVec("harbor_jobservice_target_latency_seconds", typeGauge,
+		"The time in seconds the target took to respond to the latest health check.", "target_id")
+
+	all = []*Vec{QueueDepth, Workers, StateDuration, Runs, Retries, BytesTransferred, Coalesced,
+		TargetUp, TargetLatency}
+)
+
+type sample struct {
+	labels []string
+	value  float64
+	count  int64
+}
+
+// Vec is a metric partitioned by a set of labels
+type Vec struct {
+	name       string
+	typ        string
+	help       string
+	labelNames []string
+	lock       sync.Mutex
+	samples    map[string]*sample
+}
+
+func newVec(name, typ, help string, labelNames ...string) *Vec {
+	return &Vec{
+		name:       name,
+		typ:        typ,
+		help:       help,
+		labelNames: labelNames,
+		samples:    map[string]*sample{},
+	}
+}
+
+func (v *Vec) get(labels []string) *sample {
+	if len(labels) != len(v.labelNames) {
+		panic(fmt.Sprintf("%s: expected %d label values, got %d", v.name, len(v.labelNames), len(labels)))
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := v.samples[key]
+	if !ok {
+		s = &sample{labels: labels}
+		v.samples[key] = s
+	}
+	return s
+}
+
+// Add adds value to the sample with the label values, it is used by counters and gauges
+func (v *Vec) Add(value float64, labels ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.get(labels).value += value
+}
+
+// Inc increases the sample with the label values by 1
+func (v *Vec) Inc(labels ...string) {
+	v.Add(1, labels...)
+}
+
+// Set sets the sample with the label values, it is used by gauges
+func (v *Vec) Set(value float64, labels ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.get(labels).value = value
+}
+
+// Observe adds an observation to the sample with the label values, it is used by summaries
+func (v *Vec) Observe(value float64, labels ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	s := v.get(labels)
+	s.value += value
+	s.count++
+}
+
+// Reset removes all samples, it is used by gauges which are collected on demand
+func (v *Vec) Reset() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.samples = map[string]*sample{}
+}
+
+func (v *Vec) write(w io.Writer) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(v.samples))
+	for k := range v.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.samples[k]
+		labels := v.formatLabels(s.labels)
+		var err error
+		if v.typ == typeSummary {
+			_, err = fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", v.name, labels,
+				formatValue(s.value), v.name, labels, s.count)
+		} else {
+			_, err = fmt.Fprintf(w, "%s%s %s\n", v.name, labels, formatValue(s.value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retain removes the samples whose values of the label are not in values, the samples
+// whose values of the label are empty or "0", which are the jobs without policies or
+// targets, are kept. It does nothing if the metric does not have the label.
+func (v *Vec) Retain(label string, values map[string]bool) {
+	index := -1
+	for i, name := range v.labelNames {
+		if name == label {
+			index = i
+		}
+	}
+	if index < 0 {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	for k, s := range v.samples {
+		if value := s.labels[index]; len(value) != 0 && value != "0" && !values[value] {
+			delete(v.samples, k)
+		}
+	}
+}
+
+func (v *Vec) formatLabels(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", v.labelNames[i], labelEscaper.Replace(value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes the characters which must be escaped in label values of
+// the Prometheus text format, the others are written as they are
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Retain removes the samples whose values of the label are not in values from all
+// metrics which have the label, so the series of deleted policies and targets are removed
+func Retain(label string, values map[string]bool) {
+	for _, v := range all {
+		v.Retain(label, values)
+	}
+}
+
+// Write writes all metrics to w in Prometheus text format
+func Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range all {
+		if err := v.write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	defer func() {
+		for _, v := range all {
+			v.Reset()
+		}
+	}()
+
+	Retries.Inc("1", "2", "transfer")
+	Retries.Add(2, "1", "2", "transfer")
+	Workers.Set(3, "busy")
+	Workers.Set(1, "busy")
+	StateDuration.Observe(1.5, "1", "2", "transfer", "running")
+	StateDuration.Observe(2, "1", "2", "transfer", "running")
+
+	buf := &bytes.Buffer{}
+	if err := Write(buf); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+	out := buf.String()
+	expected := []string{
+		"# TYPE harbor_jobservice_job_retries_total counter\n",
+		`harbor_jobservice_job_retries_total{policy_id="1",target_id="2",operation="transfer"} 3` + "\n",
+		`harbor_jobservice_workers{state="busy"} 1` + "\n",
+		"# TYPE harbor_jobservice_job_state_duration_seconds summary\n",
+		`harbor_jobservice_job_state_duration_seconds_sum{policy_id="1",target_id="2",operation="transfer",state="running"} 3.5` + "\n",
+		`harbor_jobservice_job_state_duration_seconds_count{policy_id="1",target_id="2",operation="transfer",state="running"} 2` + "\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected %q in output:\n%s", e, out)
+		}
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic when the count of label values mismatches")
+		}
+	}()
+	Retries.Inc("1")
+}
+
+func TestFormatLabels(t *testing.T) {
+	v := newVec("test", typeGauge, "test", "name")
+	labels := v.formatLabels([]string{"a\\b\"c\nd\té"})
+	if expected := `{name="a\\b\"c\nd` + "\té" + `"}`; labels != expected {
+		t.Errorf("unexpected labels: %s != %s", labels, expected)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	v := newVec("test", typeCounter, "test", "policy_id", "operation")
+	v.Inc("1", "transfer")
+	v.Inc("2", "transfer")
+	v.Inc("", "delete")
+	v.Inc("0", "delete")
+
+	v.Retain("policy_id", map[string]bool{"1": true})
+	// the metric does not have the label
+	v.Retain("target_id", map[string]bool{})
+
+	buf := &bytes.Buffer{}
+	if err := v.write(buf); err != nil {
+		t.Fatalf("failed to write metric: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `test{policy_id="1",operation="transfer"} 1`) ||
+		!strings.Contains(out, `test{policy_id="",operation="delete"} 1`) ||
+		!strings.Contains(out, `test{policy_id="0",operation="delete"} 1`) ||
+		strings.Contains(out, `policy_id="2"`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	// all policies have been deleted
+	v.Retain("policy_id", map[string]bool{})
+	buf.Reset()
+	if err := v.write(buf); err != nil {
+		t.Fatalf("failed to write metric: %v", err)
+	}
+	out = buf.String()
+	if !strings.Contains(out, `test{policy_id="0",operation="delete"} 1`) ||
+		strings.Contains(out, `policy_id="1"`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,309 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+)
+
+// Adapter wraps the operations whose implementations differ between the types of targets
+type Adapter interface {
+	// CreateProject creates the project on the target, it returns ErrConflict if the
+	// project already exists and does nothing if the target has no notion of project
+	CreateProject(name string, public int) error
+	// DeleteRepository deletes the repository on the target, it returns errNotFound
+	// if the repository does not exist
+	DeleteRepository(repository string) error
+	// DeleteTag deletes the tag of the repository on the target, it returns errNotFound
+	// if the tag does not exist and a *sharedManifestError if the tag can not be deleted
+	// without deleting the other tags which refer to the same manifest
+	DeleteTag(repository, tag string) error
+	// ListTags lists the tags of the repository on the target, it returns errNotFound
+	// if the repository does not exist
+	ListTags(repository string) ([]string, error)
+}
+
+// NewAdapter returns the adapter for the type of target, the requests are sent
+// to the target through the transport
+func NewAdapter(targetType int, url, username, password string, transport http.RoundTripper) (Adapter, error) {
+	switch targetType {
+	case models.RepTargetTypeHarbor:
+		return &harborAdapter{
+			url:       strings.TrimRight(url, "/"),
+			username:  username,
+			password:  password,
+			transport: transport,
+		}, nil
+	case models.RepTargetTypeRegistry:
+		return &registryAdapter{
+			url:       url,
+			username:  username,
+			password:  password,
+			transport: transport,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported target type: %d", targetType)
+	}
+}
+
+// harborAdapter manages projects and repositories through the API of Harbor
+type harborAdapter struct {
+	url       string
+	username  string
+	password  string
+	transport http.RoundTripper
+}
+
+func (h *harborAdapter) CreateProject(name string, public int) error {
+	project := struct {
+		ProjectName string `json:"project_name"`
+		Public      int    `json:"public"`
+	}{
+		ProjectName: name,
+		Public:      public,
+	}
+
+	data, err := json.Marshal(project)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", h.url+"/api/projects/", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(h.username, h.password)
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// version 0.1.1's reponse code is 200
+	if resp.StatusCode == http.StatusCreated ||
+		resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		return ErrConflict
+	}
+
+	message, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("failed to create project %s on %s with user %s: %d %s",
+		name, h.url, h.username, resp.StatusCode, string(message))
+}
+
+func (h *harborAdapter) DeleteRepository(repository string) error {
+	return h.delete(h.url + "/api/repositories/?repo_name=" + repository)
+}
+
+func (h *harborAdapter) DeleteTag(repository, tag string) error {
+	return h.delete(h.url + "/api/repositories/?repo_name=" + repository + "&tag=" + tag)
+}
+
+func (h *harborAdapter) ListTags(repository string) ([]string, error) {
+	return listRemoteTags(h.url, h.transport, h.username, h.password, repository)
+}
+
+func (h *harborAdapter) delete(url string) error {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(h.username, h.password)
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d %s", resp.StatusCode, string(b))
+}
+
+func (h *harborAdapter) client() *http.Client {
+	return &http.Client{
+		Transport: h.transport,
+	}
+}
+
+// registryAdapter deletes repositories through the API of Docker Registry v2, the
+// registry has no notion of project so nothing needs to be created before pushing
+type registryAdapter struct {
+	url       string
+	username  string
+	password  string
+	transport http.RoundTripper
+}
+
+func (r *registryAdapter) CreateProject(name string, public int) error {
+	return nil
+}
+
+// DeleteRepository deletes the manifests all tags of the repository refer to as the
+// registry can not delete a repository
+func (r *registryAdapter) DeleteRepository(repository string) error {
+	client, err := r.repositoryClient(repository)
+	if err != nil {
+		return err
+	}
+
+	tags, err := client.ListTag()
+	if err != nil {
+		return convertNotFound(err)
+	}
+	if len(tags) == 0 {
+		return errNotFound
+	}
+
+	deleted := map[string]bool{}
+	for _, tag := range tags {
+		digest, exist, err := client.ManifestExist(tag)
+		if err != nil {
+			return convertNotFound(err)
+		}
+		if !exist || deleted[digest] {
+			continue
+		}
+		if err := convertNotFound(client.DeleteManifest(digest)); err != nil && err != errNotFound {
+			return err
+		}
+		deleted[digest] = true
+	}
+	return nil
+}
+
+// DeleteTag deletes the manifest the tag refers to by its digest as the registry can
+// not delete a tag. Deleting the manifest deletes the other tags which refer to it as
+// well, so a *sharedManifestError listing them is returned instead if there are any.
+func (r *registryAdapter) DeleteTag(repository, tag string) error {
+	client, err := r.repositoryClient(repository)
+	if err != nil {
+		return err
+	}
+
+	digest, exist, err := client.ManifestExist(tag)
+	if err != nil {
+		return convertNotFound(err)
+	}
+	if !exist {
+		return errNotFound
+	}
+
+	tags, err := client.ListTag()
+	if err != nil {
+		return convertNotFound(err)
+	}
+	shared := []string{}
+	for _, t := range tags {
+		if t == tag {
+			continue
+		}
+		d, exist, err := client.ManifestExist(t)
+		if err != nil {
+			return convertNotFound(err)
+		}
+		if exist && d == digest {
+			shared = append(shared, t)
+		}
+	}
+	if len(shared) > 0 {
+		return &sharedManifestError{
+			tag:    tag,
+			digest: digest,
+			shared: shared,
+		}
+	}
+
+	return convertNotFound(client.DeleteManifest(digest))
+}
+
+func (r *registryAdapter) repositoryClient(repository string) (*registry.Repository, error) {
+	return newRepositoryClient(r.url, r.transport, auth.NewBasicAuthCredential(r.username, r.password),
+		repository, "repository", repository, "pull", "push", "*")
+}
+
+func (r *registryAdapter) ListTags(repository string) ([]string, error) {
+	return listRemoteTags(r.url, r.transport, r.username, r.password, repository)
+}
+
+// listRemoteTags lists the tags of the repository through the API of Docker Registry v2
+func listRemoteTags(url string, transport http.RoundTripper, username, password, repository string) ([]string, error) {
+	client, err := newRepositoryClient(url, transport, auth.NewBasicAuthCredential(username, password),
+		repository, "repository", repository, "pull")
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := client.ListTag()
+	if err != nil {
+		return nil, convertNotFound(err)
+	}
+	return tags, nil
+}
+
+// sharedManifestError is returned when a tag is not deleted as the manifest it refers
+// to is shared with other tags which would be deleted with it
+type sharedManifestError struct {
+	tag    string
+	digest string
+	shared []string
+}
+
+func (e *sharedManifestError) Error() string {
+	return fmt.Sprintf("the manifest %s of tag %s is shared with the tags %v which would be deleted as well",
+		e.digest, e.tag, e.shared)
+}
+
+// convertNotFound converts the 404 error returned by registry to errNotFound
+func convertNotFound(err error) error {
+	if e, ok := err.(*registry_error.Error); ok && e.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	return err
+}
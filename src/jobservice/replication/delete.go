@@ -20,13 +20,7 @@ import (
 
 	"github.com/vmware/harbor/src/common/models"
 	"github.com/vmware/harbor/src/common/utils/log"
-	//"github.com/vmware/harbor/src/common/utils/registry"
-	//"github.com/vmware/harbor/src/common/utils/registry/auth"
-	"crypto/tls"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strings"
+	"github.com/vmware/harbor/src/common/utils/registry"
 )
 
 const (
@@ -42,34 +36,43 @@ var (
 type Deleter struct {
 	repository string // prject_name/repo_name
 	tags       []string
+	// tagFilter selects the tags to delete when no tags are specified, nil means
+	// the whole repository is deleted
+	tagFilter func(tags []string) []string
 
-	dstURL string // url of target registry
-	dstUsr string // username ...
-	dstPwd string // username ...
+	dstURL  string // url of target registry
+	dstUsr  string // username ...
+	dstPwd  string // username ...
+	dstType int    // type of target registry
 
-	insecure bool
-
-	//dstClient *registry.Repository
+	transportConfig *registry.TransportConfig // TLS and proxy settings of target registry
 
 	logger *log.Logger
 }
 
 // NewDeleter returns a Deleter
-func NewDeleter(repository string, tags []string, dstURL, dstUsr, dstPwd string, insecure bool, logger *log.Logger) *Deleter {
+func NewDeleter(repository string, tags []string, dstURL, dstUsr, dstPwd string, dstType int, transportConfig *registry.TransportConfig, logger *log.Logger) *Deleter {
 	deleter := &Deleter{
-		repository: repository,
-		tags:       tags,
-		dstURL:     dstURL,
-		dstUsr:     dstUsr,
-		dstPwd:     dstPwd,
-		insecure:   insecure,
-		logger:     logger,
+		repository:      repository,
+		tags:            tags,
+		dstURL:          dstURL,
+		dstUsr:          dstUsr,
+		dstPwd:          dstPwd,
+		dstType:         dstType,
+		transportConfig: transportConfig,
+		logger:          logger,
 	}
 	deleter.logger.Infof("initialization completed: repository: %s, tags: %v, destination URL: %s, insecure: %v, destination user: %s",
-		deleter.repository, deleter.tags, deleter.dstURL, deleter.insecure, deleter.dstUsr)
+		deleter.repository, deleter.tags, deleter.dstURL, transportConfig != nil && transportConfig.Insecure, deleter.dstUsr)
 	return deleter
 }
 
+// SetTagFilter sets the filter which selects the tags to delete when no tags are
+// specified, the tags of the repository are listed from the target registry.
+func (d *Deleter) SetTagFilter(filter func(tags []string) []string) {
+	d.tagFilter = filter
+}
+
 // Exit ...
 func (d *Deleter) Exit() error {
 	return nil
@@ -80,19 +83,47 @@ func (d *Deleter) Enter() (string, error) {
 	state, err := d.enter()
 	if err != nil && retry(err) {
 		d.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
 }
 
 func (d *Deleter) enter() (string, error) {
-	url := strings.TrimRight(d.dstURL, "/") + "/api/repositories/"
+	transport, err := registry.GetTransport(d.transportConfig)
+	if err != nil {
+		d.logger.Errorf("an error occurred while loading transport settings of %s: %v", d.dstURL, err)
+		return "", err
+	}
+
+	adapter, err := NewAdapter(d.dstType, d.dstURL, d.dstUsr, d.dstPwd, transport)
+	if err != nil {
+		d.logger.Errorf("an error occurred while creating adapter for %s: %v", d.dstURL, err)
+		return "", err
+	}
+
+	tags := d.tags
+	if len(tags) == 0 && d.tagFilter != nil {
+		all, err := adapter.ListTags(d.repository)
+		if err != nil {
+			if err == errNotFound {
+				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
+				return models.JobFinished, nil
+			}
+			d.logger.Errorf("an error occurred while listing tags of %s on %s with user %s: %v", d.repository, d.dstURL, d.dstUsr, err)
+			return "", err
+		}
+
+		tags = d.tagFilter(all)
+		d.logger.Infof("tags of %s selected by the tag filter: %v", d.repository, tags)
+		if len(tags) == 0 {
+			return models.JobFinished, nil
+		}
+	}
 
 	// delete repository
-	if len(d.tags) == 0 {
-		u := url + "?repo_name=" + d.repository
-		if err := del(u, d.dstUsr, d.dstPwd, d.insecure); err != nil {
+	if len(tags) == 0 {
+		if err := adapter.DeleteRepository(d.repository); err != nil {
 			if err == errNotFound {
 				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
 				return models.JobFinished, nil
@@ -109,13 +140,16 @@ func (d *Deleter) enter() (string, error) {
 	}
 
 	// delele tags
-	for _, tag := range d.tags {
-		u := url + "?repo_name=" + d.repository + "&tag=" + tag
-		if err := del(u, d.dstUsr, d.dstPwd, d.insecure); err != nil {
+	for _, tag := range tags {
+		if err := adapter.DeleteTag(d.repository, tag); err != nil {
 			if err == errNotFound {
 				d.logger.Warningf("repository %s does not exist on %s", d.repository, d.dstURL)
 				continue
 			}
+			if _, ok := err.(*sharedManifestError); ok {
+				d.logger.Warningf("%s:%s on %s is not deleted: %v", d.repository, tag, d.dstURL, err)
+				continue
+			}
 
 			d.logger.Errorf("an error occurred while deleting repository %s:%s on %s with user %s: %v", d.repository, tag, d.dstURL, d.dstUsr, err)
 			return "", err
@@ -123,79 +157,4 @@ func (d *Deleter) enter() (string, error) {
 		d.logger.Infof("repository %s:%s on %s has been deleted", d.repository, tag, d.dstURL)
 	}
 	return models.JobFinished, nil
-
-	/*
-		// the follow codes can be used for non-harbor repository deletion
-		dstCred := auth.NewBasicAuthCredential(d.dstUsr, d.dstPwd)
-		dstClient, err := newRepositoryClient(d.dstURL, d.insecure, dstCred,
-			d.repository, "repository", d.repository, "pull", "push", "*")
-		if err != nil {
-			d.logger.Errorf("an error occurred while creating destination repository client: %v", err)
-			return "", err
-		}
-
-		d.dstClient = dstClient
-
-		if len(d.tags) == 0 {
-			tags, err := d.dstClient.ListTag()
-			if err != nil {
-				d.logger.Errorf("an error occurred while listing tags of repository %s on %s with user %s: %v", d.repository, d.dstURL, d.dstUsr, err)
-				return "", err
-			}
-
-			d.tags = append(d.tags, tags...)
-		}
-
-		d.logger.Infof("tags %v will be deleted", d.tags)
-
-		for _, tag := range d.tags {
-
-			if err := d.dstClient.DeleteTag(tag); err != nil {
-				d.logger.Errorf("an error occurred while deleting repository %s:%s on %s with user %s: %v", d.repository, tag, d.dstURL, d.dstUsr, err)
-				return "", err
-			}
-
-			d.logger.Infof("repository %s:%s on %s has been deleted", d.repository, tag, d.dstURL)
-		}
-
-		return models.JobFinished, nil
-	*/
-}
-
-func del(url, username, password string, insecure bool) error {
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-
-	req.SetBasicAuth(username, password)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: insecure,
-			},
-		},
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		return nil
-	}
-
-	if resp.StatusCode == http.StatusNotFound {
-		return errNotFound
-	}
-
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return fmt.Errorf("%d %s", resp.StatusCode, string(b))
 }
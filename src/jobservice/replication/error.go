@@ -19,6 +19,21 @@ import (
 	"net"
 )
 
+// RetryError is returned by the state handlers when the job fails because of an error
+// which may be recovered by retrying the job later, such as a network failure
+type RetryError struct {
+	Err error
+}
+
+func (r *RetryError) Error() string {
+	return r.Err.Error()
+}
+
+// Retryable returns true as the job can be retried
+func (r *RetryError) Retryable() bool {
+	return true
+}
+
 func retry(err error) bool {
 	if err == nil {
 		return false
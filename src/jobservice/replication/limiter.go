@@ -0,0 +1,136 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// transferLimiter limits the count of blobs transferred concurrently to or from each
+// target by all the jobs, each target has a slot for every concurrent transfer.
+type transferLimiter struct {
+	lock  sync.Mutex
+	slots map[string]chan struct{}
+}
+
+var limiter = &transferLimiter{
+	slots: map[string]chan struct{}{},
+}
+
+// acquire blocks until a slot of the target is free or cancel is closed, limit is the
+// count of slots the target has and 0 means no limit. The returned function releases
+// the slot, it is nil if cancel is closed before a slot is free.
+func (t *transferLimiter) acquire(target string, limit int, cancel <-chan struct{}) func() {
+	if limit <= 0 {
+		return func() {}
+	}
+
+	t.lock.Lock()
+	slots, ok := t.slots[target]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		t.slots[target] = slots
+	}
+	t.lock.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() {
+			<-slots
+		}
+	case <-cancel:
+		return nil
+	}
+}
+
+// bandwidth limits the rate of the data transferred with a target by all the jobs
+type bandwidth struct {
+	lock sync.Mutex
+	rate int64     // bytes per second
+	next time.Time // the time before which the data read so far is not allowed
+}
+
+var bandwidths = struct {
+	lock sync.Mutex
+	m    map[string]*bandwidth
+}{
+	m: map[string]*bandwidth{},
+}
+
+// throttle returns a reader which reads from r at no more than rate bytes per second
+// in total with all the other readers of the target
+func throttle(target string, rate int64, r io.Reader) io.Reader {
+	bandwidths.lock.Lock()
+	bw, ok := bandwidths.m[target]
+	if !ok {
+		bw = &bandwidth{}
+		bandwidths.m[target] = bw
+	}
+	bandwidths.lock.Unlock()
+
+	bw.lock.Lock()
+	// the limit may have been changed since the last job
+	bw.rate = rate
+	bw.lock.Unlock()
+
+	return &throttledReader{
+		reader:    r,
+		bandwidth: bw,
+	}
+}
+
+// wait blocks until n more bytes are allowed to be transferred
+func (b *bandwidth) wait(n int) {
+	b.lock.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.rate))
+	delay := b.next.Sub(now)
+	b.lock.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type throttledReader struct {
+	reader    io.Reader
+	bandwidth *bandwidth
+}
+
+// Read reads at most as many bytes as the rate allows in 100 milliseconds at a time,
+// so the readers of the target share the bandwidth evenly
+func (t *throttledReader) Read(p []byte) (int, error) {
+	t.bandwidth.lock.Lock()
+	max := int(t.bandwidth.rate / 10)
+	t.bandwidth.lock.Unlock()
+	if max < 1 {
+		max = 1
+	}
+	if len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := t.reader.Read(p)
+	if n > 0 {
+		t.bandwidth.wait(n)
+	}
+	return n, err
+}
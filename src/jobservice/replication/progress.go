@@ -0,0 +1,122 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+)
+
+// Progress tracks the progress of a transfer job, it is shared by the state
+// handlers of the job and is safe for concurrent use.
+type Progress struct {
+	lock      sync.Mutex
+	progress  models.RepJobProgress
+	startTime time.Time
+}
+
+// NewProgress returns an instance of Progress whose clock starts now
+func NewProgress() *Progress {
+	return &Progress{
+		startTime: time.Now(),
+	}
+}
+
+// SetTags sets the count of tags need to be replicated
+func (p *Progress) SetTags(total int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.TagsTotal = total
+}
+
+// TagDone marks a tag as replicated
+func (p *Progress) TagDone() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.TagsDone++
+}
+
+// AddBlobs adds blobs need to be transferred and their total size
+func (p *Progress) AddBlobs(count int, size int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.BlobsTotal += count
+	p.progress.BytesTotal += size
+}
+
+// StartBlob marks the blob as being transferred, the current blob is the one started
+// last if several blobs are transferred concurrently
+func (p *Progress) StartBlob(digest string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.CurrentBlob = digest
+}
+
+// SetUpload records the location and offset of the chunked upload of the blob, the
+// uploads of the blobs transferred concurrently are recorded separately
+func (p *Progress) SetUpload(digest, location string, offset int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.progress.Uploads == nil {
+		p.progress.Uploads = map[string]*models.RepBlobUpload{}
+	}
+	p.progress.Uploads[digest] = &models.RepBlobUpload{
+		Location: location,
+		Offset:   offset,
+	}
+}
+
+// BlobDone marks the blob as transferred
+func (p *Progress) BlobDone(digest string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.BlobsDone++
+	delete(p.progress.Uploads, digest)
+	if p.progress.CurrentBlob == digest {
+		p.progress.CurrentBlob = ""
+	}
+}
+
+// Write implements io.Writer to count the bytes transferred, so the data
+// of blob can be teed to it
+func (p *Progress) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.BytesTransferred += int64(len(b))
+	return len(b), nil
+}
+
+// Snapshot returns the current progress
+func (p *Progress) Snapshot() *models.RepJobProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	progress := p.progress
+	if len(p.progress.Uploads) != 0 {
+		progress.Uploads = make(map[string]*models.RepBlobUpload, len(p.progress.Uploads))
+		for digest, upload := range p.progress.Uploads {
+			u := *upload
+			progress.Uploads[digest] = &u
+		}
+	}
+	if elapsed := now.Sub(p.startTime).Seconds(); elapsed > 0 {
+		progress.Throughput = int64(float64(progress.BytesTransferred) / elapsed)
+	}
+	progress.UpdateTime = now
+	return &progress
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package replication
+
+import (
+	"net/http"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	registry_error "github.com/vmware/harbor/src/common/utils/registry/error"
+)
+
+// Diff compares the tags of the repository and their digests on the source registry with
+// the ones on the destination registry, only the tags selected by the tag filter are compared.
+// The extra tags which refer to the same manifests as the tags kept on the destination registry
+// are reported as shared instead of extra, as deleting their manifests deletes the kept tags too.
+func (b *BaseHandler) Diff() (*models.RepDiff, error) {
+	if err := b.initClients(); err != nil {
+		return nil, err
+	}
+
+	srcTags, err := listTags(b.srcClient)
+	if err != nil {
+		return nil, err
+	}
+	dstTags, err := listTags(b.dstClient)
+	if err != nil {
+		return nil, err
+	}
+	if b.tagFilter != nil {
+		srcTags = b.tagFilter(srcTags)
+		dstTags = b.tagFilter(dstTags)
+	}
+
+	diff := &models.RepDiff{
+		Repository: b.repository,
+		Missing:    []string{},
+		Stale:      []string{},
+		Extra:      []string{},
+		Shared:     []string{},
+	}
+
+	dst := map[string]bool{}
+	for _, tag := range dstTags {
+		dst[tag] = true
+	}
+
+	// the digests of the manifests the kept tags refer to on the destination registry
+	kept := map[string]bool{}
+	src := map[string]bool{}
+	for _, tag := range srcTags {
+		src[tag] = true
+		if !dst[tag] {
+			diff.Missing = append(diff.Missing, tag)
+			continue
+		}
+
+		srcDigest, _, err := b.srcClient.ManifestExist(tag)
+		if err != nil {
+			return nil, err
+		}
+		dstDigest, exist, err := b.dstClient.ManifestExist(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !exist {
+			diff.Missing = append(diff.Missing, tag)
+			continue
+		}
+		kept[dstDigest] = true
+		if srcDigest != dstDigest {
+			diff.Stale = append(diff.Stale, tag)
+		}
+	}
+
+	for _, tag := range dstTags {
+		if src[tag] {
+			continue
+		}
+		dstDigest, exist, err := b.dstClient.ManifestExist(tag)
+		if err != nil {
+			return nil, err
+		}
+		if exist && kept[dstDigest] {
+			diff.Shared = append(diff.Shared, tag)
+			continue
+		}
+		diff.Extra = append(diff.Extra, tag)
+	}
+
+	return diff, nil
+}
+
+// listTags lists the tags of the repository, a repository which does not exist has no tag
+func listTags(client *registry.Repository) ([]string, error) {
+	tags, err := client.ListTag()
+	if e, ok := err.(*registry_error.Error); ok && e.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+	return tags, err
+}
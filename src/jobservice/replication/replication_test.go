@@ -1,9 +1,326 @@
 package replication
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
 )
 
 func TestMain(t *testing.T) {
 }
 
+
+func TestProgress(t *testing.T) {
+	p := NewProgress()
+	p.SetTags(2)
+	p.AddBlobs(2, 10)
+	p.StartBlob("sha256:1")
+	if _, err := io.Copy(ioutil.Discard, io.TeeReader(strings.NewReader("12345"), p)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+
+	s := p.Snapshot()
+	if s.CurrentBlob != "sha256:1" || s.BytesTransferred != 5 || s.BytesTotal != 10 {
+		t.Errorf("unexpected progress: %+v", s)
+	}
+
+	// the uploads of the blobs transferred concurrently are recorded separately
+	p.StartBlob("sha256:2")
+	p.SetUpload("sha256:1", "http://registry/v2/library/hello-world/blobs/uploads/1", 5)
+	p.SetUpload("sha256:2", "http://registry/v2/library/hello-world/blobs/uploads/2", 3)
+	s = p.Snapshot()
+	if len(s.Uploads) != 2 ||
+		s.Uploads["sha256:1"].Location != "http://registry/v2/library/hello-world/blobs/uploads/1" ||
+		s.Uploads["sha256:1"].Offset != 5 || s.Uploads["sha256:2"].Offset != 3 {
+		t.Errorf("unexpected uploads: %+v", s.Uploads)
+	}
+
+	// the snapshot is not changed by the progress made later
+	p.SetUpload("sha256:1", "http://registry/v2/library/hello-world/blobs/uploads/1", 8)
+	if s.Uploads["sha256:1"].Offset != 5 {
+		t.Errorf("unexpected upload in snapshot: %+v", s.Uploads["sha256:1"])
+	}
+
+	p.BlobDone("sha256:2")
+	s = p.Snapshot()
+	if s.CurrentBlob != "" || len(s.Uploads) != 1 || s.Uploads["sha256:1"].Offset != 8 || s.BlobsDone != 1 {
+		t.Errorf("unexpected progress: %+v", s)
+	}
+
+	p.BlobDone("sha256:1")
+	p.TagDone()
+	s = p.Snapshot()
+	if len(s.Uploads) != 0 || s.BlobsDone != 2 || s.BlobsTotal != 2 ||
+		s.TagsDone != 1 || s.TagsTotal != 2 {
+		t.Errorf("unexpected progress: %+v", s)
+	}
+}
+
+func TestHarborAdapter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/projects/":
+			w.WriteHeader(http.StatusConflict)
+		case r.Method == "DELETE" && r.URL.Query().Get("tag") == "latest":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	adapter, err := NewAdapter(models.RepTargetTypeHarbor, server.URL, "admin", "Harbor12345", registry.GetHTTPTransport(true))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	if err := adapter.CreateProject("library", 1); err != ErrConflict {
+		t.Errorf("unexpected error: %v != %v", err, ErrConflict)
+	}
+	if err := adapter.DeleteTag("library/hello-world", "latest"); err != nil {
+		t.Errorf("failed to delete tag: %v", err)
+	}
+	if err := adapter.DeleteRepository("library/hello-world"); err != errNotFound {
+		t.Errorf("unexpected error: %v != %v", err, errNotFound)
+	}
+}
+
+func TestRegistryAdapterSharedManifest(t *testing.T) {
+	tags := newTagServer(map[string]string{"1.0": "sha256:1", "latest": "sha256:1", "2.0": "sha256:2"})
+	defer tags.Close()
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		tags.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	adapter, err := NewAdapter(models.RepTargetTypeRegistry, server.URL, "user", "password", registry.GetHTTPTransport(false))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	err = adapter.DeleteTag("library/app", "1.0")
+	if e, ok := err.(*sharedManifestError); !ok || !reflect.DeepEqual(e.shared, []string{"latest"}) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("unexpected deleted manifests: %v", deleted)
+	}
+
+	if err := adapter.DeleteTag("library/app", "2.0"); err != nil {
+		t.Errorf("failed to delete tag: %v", err)
+	}
+	if err := adapter.DeleteRepository("library/app"); err != nil {
+		t.Errorf("failed to delete repository: %v", err)
+	}
+	expected := []string{"/v2/library/app/manifests/sha256:2", "/v2/library/app/manifests/sha256:1",
+		"/v2/library/app/manifests/sha256:2"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deleted manifests: %v != %v", deleted, expected)
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	adapter, err := NewAdapter(models.RepTargetTypeRegistry, "http://registry:5000", "", "", registry.GetHTTPTransport(false))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	if err := adapter.CreateProject("library", 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := NewAdapter(2, "http://registry:5000", "", "", registry.GetHTTPTransport(false)); err == nil {
+		t.Errorf("expected error for unsupported target type")
+	}
+}
+
+func TestTransferLimiter(t *testing.T) {
+	l := &transferLimiter{
+		slots: map[string]chan struct{}{},
+	}
+
+	release1 := l.acquire("http://registry", 2, nil)
+	release2 := l.acquire("http://registry", 2, nil)
+	// slots of other targets are not shared
+	l.acquire("http://other", 2, nil)()
+	// no limit
+	l.acquire("http://registry", 0, nil)()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.acquire("http://registry", 2, nil)()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("slot should not be acquired before one is released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("slot should be acquired after one is released")
+	}
+
+	// waiting for a slot gives up once canceled
+	release1 = l.acquire("http://registry", 2, nil)
+	cancel := make(chan struct{})
+	canceled := make(chan func())
+	go func() {
+		canceled <- l.acquire("http://registry", 2, cancel)
+	}()
+	close(cancel)
+	select {
+	case release := <-canceled:
+		if release != nil {
+			t.Errorf("slot should not be acquired once canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("acquiring slot should give up once canceled")
+	}
+	release1()
+	release2()
+}
+
+func TestThrottle(t *testing.T) {
+	data := make([]byte, 300)
+	start := time.Now()
+	// the readers share the bandwidth of the target
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := io.Copy(ioutil.Discard, throttle("http://throttled", 1000, bytes.NewReader(data)))
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("failed to read from throttled reader: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("600 bytes should not be read in %v at 1000 bytes per second", elapsed)
+	}
+}
+
+// newTagServer returns a registry which serves the repository library/app with the tags
+// and their digests, the repository does not exist if tags is nil
+func newTagServer(tags map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/v2/library/app/manifests/"
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/library/app/tags/list" && tags != nil:
+			list := []string{}
+			for tag := range tags {
+				list = append(list, tag)
+			}
+			sort.Strings(list)
+			json.NewEncoder(w).Encode(map[string][]string{"tags": list})
+		case strings.HasPrefix(r.URL.Path, prefix) && len(tags[r.URL.Path[len(prefix):]]) != 0:
+			w.Header().Set("Docker-Content-Digest", tags[r.URL.Path[len(prefix):]])
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestDiff(t *testing.T) {
+	src := newTagServer(map[string]string{"1.0": "sha256:1", "1.1": "sha256:2", "2.0": "sha256:3"})
+	defer src.Close()
+	dst := newTagServer(map[string]string{"1.0": "sha256:1", "1.1": "sha256:0", "0.9": "sha256:9",
+		"latest": "sha256:1"})
+	defer dst.Close()
+	empty := newTagServer(nil)
+	defer empty.Close()
+
+	logger := log.New(os.Stdout, log.NewTextFormatter(), log.WarningLevel)
+	base := InitBaseHandler("library/app", src.URL, "secret", dst.URL, "user", "password",
+		models.RepTargetTypeRegistry, false, nil, NewProgress(), logger)
+	diff, err := base.Diff()
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Missing, []string{"2.0"}) ||
+		!reflect.DeepEqual(diff.Stale, []string{"1.1"}) ||
+		!reflect.DeepEqual(diff.Extra, []string{"0.9"}) ||
+		!reflect.DeepEqual(diff.Shared, []string{"latest"}) {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+
+	base = InitBaseHandler("library/app", src.URL, "secret", empty.URL, "user", "password",
+		models.RepTargetTypeRegistry, false, nil, NewProgress(), logger)
+	base.SetTagFilter(func(tags []string) []string {
+		selected := []string{}
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, "1.") {
+				selected = append(selected, tag)
+			}
+		}
+		return selected
+	})
+	diff, err = base.Diff()
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Missing, []string{"1.0", "1.1"}) || len(diff.Stale) != 0 || len(diff.Extra) != 0 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+}
+
+func TestDeleterTagFilter(t *testing.T) {
+	tags := newTagServer(map[string]string{"1.0": "sha256:1", "1.1": "sha256:2", "2.0": "sha256:3"})
+	defer tags.Close()
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		tags.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	logger := log.New(os.Stdout, log.NewTextFormatter(), log.WarningLevel)
+	deleter := NewDeleter("library/app", nil, server.URL, "user", "password",
+		models.RepTargetTypeRegistry, nil, logger)
+	deleter.SetTagFilter(func(tags []string) []string {
+		selected := []string{}
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, "1.") {
+				selected = append(selected, tag)
+			}
+		}
+		return selected
+	})
+	if _, err := deleter.Enter(); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	expected := []string{"/v2/library/app/manifests/sha256:1", "/v2/library/app/manifests/sha256:2"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deleted manifests: %v != %v", deleted, expected)
+	}
+}
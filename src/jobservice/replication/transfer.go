@@ -16,14 +16,13 @@
 package replication
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
@@ -51,6 +50,8 @@ const (
 var (
 	// ErrConflict represents http 409 error
 	ErrConflict = errors.New("conflict")
+	// errCanceled is returned when the job is stopped or drained before the blob is transferred
+	errCanceled = errors.New("canceled")
 )
 
 // BaseHandler holds informations shared by other state handlers
@@ -59,41 +60,72 @@ type BaseHandler struct {
 	repository string // prject_name/repo_name
 	tags       []string
 
-	srcURL    string // url of source registry
-	srcSecret string
+	srcURL  string // url of source registry
+	srcCred auth.Credential
 
-	dstURL string // url of target registry
-	dstUsr string // username ...
-	dstPwd string // password ...
+	dstURL  string // url of target registry
+	dstUsr  string // username ...
+	dstPwd  string // password ...
+	dstType int    // type of target registry
+	dstCred auth.Credential
 
-	insecure bool // whether skip secure check when using https
+	pull bool // whether the source is the target registry and the destination is local
+
+	tagFilter func(tags []string) []string // selects the tags listed from the source registry
+
+	chunkSize int64             // size of chunks in which blobs are pushed, 0 means monolithic upload
+	uploads   map[string]string // locations of the uploads left by previous attempt of the job keyed by blob
+	cancel    <-chan struct{}   // closed when the job is stopped or drained
+
+	targetID int64 // ID of the target whose blob index is used to mount blobs, 0 means no mounting
+
+	pinned string // digest the only tag is replicated at, the manifest the tag points to is replicated if it is empty
+	jobID  int64  // ID of the job on which the digest replicated is recorded, 0 means not recording
+
+	concurrency        int // count of blobs transferred concurrently
+	targetMaxTransfers int // max count of blobs transferred concurrently with the target by all jobs
+
+	bandwidthLimit int64 // max rate in bytes per second of blobs transferred with the target by all jobs
+
+	insecure        bool                      // whether skip secure check when using https
+	targetTransport *registry.TransportConfig // TLS and proxy settings of the target registry, nil means using insecure
 
 	srcClient *registry.Repository
 	dstClient *registry.Repository
 
-	manifest distribution.Manifest // manifest of tags[0]
+	manifest distribution.Manifest // manifest of tags[0], or of platforms[0] if tags[0] is a manifest list
 	digest   string                //digest of tags[0]'s manifest
 	blobs    []string              // blobs need to be transferred for tags[0]
 
+	list       *registry.ManifestList // manifest list of tags[0]
+	listDigest string                 // digest of the manifest list
+	platforms  []string               // digests of the platform manifests of the list need to be replicated
+
 	blobsExistence map[string]bool //key: digest of blob, value: existence
 
+	progress *Progress
+
 	logger *log.Logger
 }
 
 // InitBaseHandler initializes a BaseHandler.
 func InitBaseHandler(repository, srcURL, srcSecret,
-	dstURL, dstUsr, dstPwd string, insecure bool, tags []string, logger *log.Logger) *BaseHandler {
+	dstURL, dstUsr, dstPwd string, dstType int, insecure bool, tags []string, progress *Progress,
+	logger *log.Logger) *BaseHandler {
 
 	base := &BaseHandler{
 		repository:     repository,
 		tags:           tags,
 		srcURL:         srcURL,
-		srcSecret:      srcSecret,
+		srcCred:        auth.NewCookieCredential(&http.Cookie{Name: models.UISecretCookie, Value: srcSecret}),
 		dstURL:         dstURL,
 		dstUsr:         dstUsr,
 		dstPwd:         dstPwd,
+		dstType:        dstType,
+		dstCred:        auth.NewBasicAuthCredential(dstUsr, dstPwd),
 		insecure:       insecure,
 		blobsExistence: make(map[string]bool, 10),
+		progress:       progress,
 		logger:         logger,
 	}
 
@@ -102,6 +134,173 @@ func InitBaseHandler(repository, srcURL, srcSecret,
 	return base
 }
 
+// InitPullHandler initializes a BaseHandler which replicates the repository from
+// the target registry to local, the project must exist locally.
+func InitPullHandler(repository, localURL, localSecret,
+	targetURL, targetUsr, targetPwd string, insecure bool, tags []string, progress *Progress,
+	logger *log.Logger) *BaseHandler {
+
+	base := &BaseHandler{
+		repository:     repository,
+		tags:           tags,
+		srcURL:         targetURL,
+		srcCred:        auth.NewBasicAuthCredential(targetUsr, targetPwd),
+		dstURL:         localURL,
+		dstCred:        auth.NewCookieCredential(&http.Cookie{Name: models.UISecretCookie, Value: localSecret}),
+		pull:           true,
+		insecure:       insecure,
+		blobsExistence: make(map[string]bool, 10),
+		progress:       progress,
+		logger:         logger,
+	}
+
+	base.project = getProjectName(base.repository)
+
+	return base
+}
+
+// SetTagFilter sets the filter which selects the tags to replicate when the tags
+// of the repository are listed from the source registry.
+func (b *BaseHandler) SetTagFilter(filter func(tags []string) []string) {
+	b.tagFilter = filter
+}
+
+// SetChunkSize sets the size of chunks in which the blobs are pushed, the blobs are
+// pushed in a single request if it is 0.
+func (b *BaseHandler) SetChunkSize(size int64) {
+	b.chunkSize = size
+}
+
+// ResumeUploads makes the chunked uploads of the blobs resume from the locations which
+// are left by the previous attempt of the job.
+func (b *BaseHandler) ResumeUploads(uploads map[string]*models.RepBlobUpload) {
+	b.uploads = map[string]string{}
+	for blob, upload := range uploads {
+		b.uploads[blob] = upload.Location
+	}
+}
+
+// SetCancel sets the channel which is closed when the job is stopped or drained, the
+// blobs waiting for free slots of the target are not transferred once it is closed.
+func (b *BaseHandler) SetCancel(cancel <-chan struct{}) {
+	b.cancel = cancel
+}
+
+// SetConcurrency sets the count of blobs the job transfers concurrently, and the max count
+// of blobs transferred concurrently to or from the target by all the jobs, 0 means no limit.
+func (b *BaseHandler) SetConcurrency(concurrency, targetMaxTransfers int) {
+	b.concurrency = concurrency
+	b.targetMaxTransfers = targetMaxTransfers
+}
+
+// SetBandwidthLimit sets the max rate in bytes per second of the blobs transferred with
+// the target by all the jobs, 0 means no limit.
+func (b *BaseHandler) SetBandwidthLimit(limit int64) {
+	b.bandwidthLimit = limit
+}
+
+// target returns the URL of the remote registry the job replicates to or from
+func (b *BaseHandler) target() string {
+	if b.pull {
+		return b.srcURL
+	}
+	return b.dstURL
+}
+
+// SetBlobIndex makes the blobs be mounted from other repositories of the target in which
+// they are known to exist, and records the repositories the blobs are found or pushed in.
+func (b *BaseHandler) SetBlobIndex(targetID int64) {
+	b.targetID = targetID
+}
+
+// PinDigest replicates the only tag of the handler at the digest rather than the
+// manifest the tag points to when it is replicated
+func (b *BaseHandler) PinDigest(digest string) {
+	b.pinned = digest
+}
+
+// RecordDigest records the digest of the manifest replicated for the only tag of
+// the handler on the job
+func (b *BaseHandler) RecordDigest(jobID int64) {
+	b.jobID = jobID
+}
+
+// recordDigest records the digest of the manifest replicated on the job
+func (b *BaseHandler) recordDigest(digest string) {
+	if b.jobID == 0 {
+		return
+	}
+	if err := dao.UpdateRepJobDigest(b.jobID, digest); err != nil {
+		b.logger.Warningf("failed to record the digest %s replicated by job %d: %v", digest, b.jobID, err)
+	}
+}
+
+// reference returns the reference of the manifest of tags[0] on the source registry
+func (b *BaseHandler) reference() string {
+	if len(b.pinned) != 0 {
+		return b.pinned
+	}
+	return b.tags[0]
+}
+
+// indexBlob records that the blob exists in the repository on the destination registry
+func (b *BaseHandler) indexBlob(blob string) {
+	if b.targetID == 0 {
+		return
+	}
+	if err := dao.SetRepBlobLocation(b.targetID, blob, b.repository); err != nil {
+		b.logger.Warningf("failed to record the location of blob %s on %s: %v", blob, b.dstURL, err)
+	}
+}
+
+// SetTargetTransport sets the TLS and proxy settings used to connect to the target registry
+func (b *BaseHandler) SetTargetTransport(config *registry.TransportConfig) {
+	b.targetTransport = config
+}
+
+// transports returns the transports to the source and destination registries
+func (b *BaseHandler) transports() (src, dst http.RoundTripper, err error) {
+	local := registry.GetHTTPTransport(b.insecure)
+	if b.targetTransport == nil {
+		return local, local, nil
+	}
+	target, err := registry.GetTransport(b.targetTransport)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.pull {
+		return target, local, nil
+	}
+	return local, target, nil
+}
+
+// initClients creates the clients of the repository on the source and destination registries
+func (b *BaseHandler) initClients() error {
+	srcTransport, dstTransport, err := b.transports()
+	if err != nil {
+		b.logger.Errorf("an error occurred while loading transport settings of the target: %v", err)
+		return err
+	}
+
+	srcClient, err := newRepositoryClient(b.srcURL, srcTransport, b.srcCred,
+		b.repository, "repository", b.repository, "pull", "push", "*")
+	if err != nil {
+		b.logger.Errorf("an error occurred while creating source repository client: %v", err)
+		return err
+	}
+	b.srcClient = srcClient
+
+	dstClient, err := newRepositoryClient(b.dstURL, dstTransport, b.dstCred,
+		b.repository, "repository", b.repository, "pull", "push", "*")
+	if err != nil {
+		b.logger.Errorf("an error occurred while creating destination repository client: %v", err)
+		return err
+	}
+	b.dstClient = dstClient
+
+	return nil
+}
+
 // Exit ...
 func (b *BaseHandler) Exit() error {
 	return nil
@@ -127,31 +326,16 @@ func (i *Initializer) Enter() (string, error) {
 	state, err := i.enter()
 	if err != nil && retry(err) {
 		i.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
 }
 
 func (i *Initializer) enter() (string, error) {
-	c := &http.Cookie{Name: models.UISecretCookie, Value: i.srcSecret}
-	srcCred := auth.NewCookieCredential(c)
-	srcClient, err := newRepositoryClient(i.srcURL, i.insecure, srcCred,
-		i.repository, "repository", i.repository, "pull", "push", "*")
-	if err != nil {
-		i.logger.Errorf("an error occurred while creating source repository client: %v", err)
+	if err := i.initClients(); err != nil {
 		return "", err
 	}
-	i.srcClient = srcClient
-
-	dstCred := auth.NewBasicAuthCredential(i.dstUsr, i.dstPwd)
-	dstClient, err := newRepositoryClient(i.dstURL, i.insecure, dstCred,
-		i.repository, "repository", i.repository, "pull", "push", "*")
-	if err != nil {
-		i.logger.Errorf("an error occurred while creating destination repository client: %v", err)
-		return "", err
-	}
-	i.dstClient = dstClient
 
 	if len(i.tags) == 0 {
 		tags, err := i.srcClient.ListTag()
@@ -160,7 +344,11 @@ func (i *Initializer) enter() (string, error) {
 			return "", err
 		}
 		i.tags = tags
+		if i.tagFilter != nil {
+			i.tags = i.tagFilter(tags)
+		}
 	}
+	i.progress.SetTags(len(i.tags))
 
 	i.logger.Infof("initialization completed: project: %s, repository: %s, tags: %v, source URL: %s, destination URL: %s, insecure: %v, destination user: %s",
 		i.project, i.repository, i.tags, i.srcURL, i.dstURL, i.insecure, i.dstUsr)
@@ -179,22 +367,40 @@ func (c *Checker) Enter() (string, error) {
 	state, err := c.enter()
 	if err != nil && retry(err) {
 		c.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
 }
 
 func (c *Checker) enter() (string, error) {
+	// the project of a pull replication is the local one which the policy belongs to
+	if c.pull {
+		c.logger.Infof("project %s exists on %s, skip checking", c.project, c.dstURL)
+		return StatePullManifest, nil
+	}
+
 	project, err := dao.GetProjectByName(c.project)
 	if err != nil {
 		c.logger.Errorf("an error occurred while getting project %s in DB: %v", c.project, err)
 		return "", err
 	}
 
-	err = c.createProject(project.Public)
+	_, transport, err := c.transports()
+	if err != nil {
+		c.logger.Errorf("an error occurred while loading transport settings of %s: %v", c.dstURL, err)
+		return "", err
+	}
+
+	adapter, err := NewAdapter(c.dstType, c.dstURL, c.dstUsr, c.dstPwd, transport)
+	if err != nil {
+		c.logger.Errorf("an error occurred while creating adapter for %s: %v", c.dstURL, err)
+		return "", err
+	}
+
+	err = adapter.CreateProject(c.project, project.Public)
 	if err == nil {
-		c.logger.Infof("project %s is created on %s with user %s", c.project, c.dstURL, c.dstUsr)
+		c.logger.Infof("project %s is ready on %s with user %s", c.project, c.dstURL, c.dstUsr)
 		return StatePullManifest, nil
 	}
 
@@ -211,62 +417,6 @@ func (c *Checker) enter() (string, error) {
 	return "", err
 }
 
-func (c *Checker) createProject(public int) error {
-	project := struct {
-		ProjectName string `json:"project_name"`
-		Public      int    `json:"public"`
-	}{
-		ProjectName: c.project,
-		Public:      public,
-	}
-
-	data, err := json.Marshal(project)
-	if err != nil {
-		return err
-	}
-
-	url := strings.TrimRight(c.dstURL, "/") + "/api/projects/"
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-
-	req.SetBasicAuth(c.dstUsr, c.dstPwd)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: c.insecure,
-			},
-		},
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-
-	defer resp.Body.Close()
-
-	// version 0.1.1's reponse code is 200
-	if resp.StatusCode == http.StatusCreated ||
-		resp.StatusCode == http.StatusOK {
-		return nil
-	}
-
-	if resp.StatusCode == http.StatusConflict {
-		return ErrConflict
-	}
-
-	message, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		c.logger.Errorf("an error occurred while reading message from response: %v", err)
-	}
-
-	return fmt.Errorf("failed to create project %s on %s with user %s: %d %s",
-		c.project, c.dstURL, c.dstUsr, resp.StatusCode, string(message))
-}
-
 // ManifestPuller pulls the manifest of a tag. And if no tag needs to be pulled,
 // the next state that state machine should enter is "finished".
 type ManifestPuller struct {
@@ -278,7 +428,7 @@ func (m *ManifestPuller) Enter() (string, error) {
 	state, err := m.enter()
 	if err != nil && retry(err) {
 		m.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
@@ -294,38 +444,60 @@ func (m *ManifestPuller) enter() (string, error) {
 	name := m.repository
 	tag := m.tags[0]
 
-	acceptMediaTypes := []string{schema1.MediaTypeManifest, schema2.MediaTypeManifest}
-	digest, mediaType, payload, err := m.srcClient.PullManifest(tag, acceptMediaTypes)
-	if err != nil {
-		m.logger.Errorf("an error occurred while pulling manifest of %s:%s from %s: %v", name, tag, m.srcURL, err)
-		return "", err
+	// if the manifest of the tag is a manifest list, the platform manifests it
+	// references are replicated one by one before the manifest list is pushed
+	reference := m.reference()
+	if m.list != nil {
+		reference = m.platforms[0]
 	}
-	m.digest = digest
-	m.logger.Infof("manifest of %s:%s pulled successfully from %s: %s", name, tag, m.srcURL, digest)
 
-	if strings.Contains(mediaType, "application/json") {
-		mediaType = schema1.MediaTypeManifest
-	}
+	var manifest distribution.Manifest
+	for {
+		pulled, digest, err := m.pullManifest(reference)
+		if err != nil {
+			return "", err
+		}
 
-	manifest, _, err := registry.UnMarshal(mediaType, payload)
-	if err != nil {
-		m.logger.Errorf("an error occurred while parsing manifest of %s:%s from %s: %v", name, tag, m.srcURL, err)
-		return "", err
+		list, ok := pulled.(*registry.ManifestList)
+		if !ok {
+			manifest = pulled
+			m.digest = digest
+			break
+		}
+		if m.list != nil {
+			err = fmt.Errorf("manifest %s referenced by the manifest list of %s:%s is a manifest list", reference, name, tag)
+			m.logger.Errorf("%v", err)
+			return "", err
+		}
+
+		m.list = list
+		m.listDigest = digest
+		if m.platforms, err = m.missingPlatforms(list); err != nil {
+			return "", err
+		}
+		m.logger.Infof("platform manifests of %s:%s need to be replicated to %s: %v", name, tag, m.dstURL, m.platforms)
+		if len(m.platforms) == 0 {
+			return StateTransferBlob, nil
+		}
+		reference = m.platforms[0]
 	}
 
 	m.manifest = manifest
 
 	// all blobs(layers and config)
 	var blobs []string
+	sizes := map[string]int64{}
 
 	for _, discriptor := range manifest.References() {
 		blobs = append(blobs, discriptor.Digest.String())
+		sizes[discriptor.Digest.String()] = discriptor.Size
 	}
 
 	// config is also need to be transferred if the schema of manifest is v2
 	manifest2, ok := manifest.(*schema2.DeserializedManifest)
 	if ok {
 		blobs = append(blobs, manifest2.Target().Digest.String())
+		sizes[manifest2.Target().Digest.String()] = manifest2.Target().Size
 	}
 
 	m.logger.Infof("all blobs of %s:%s from %s: %v", name, tag, m.srcURL, blobs)
@@ -333,12 +505,16 @@ func (m *ManifestPuller) enter() (string, error) {
 	for _, blob := range blobs {
 		exist, ok := m.blobsExistence[blob]
 		if !ok {
+			var err error
 			exist, err = m.dstClient.BlobExist(blob)
 			if err != nil {
 				m.logger.Errorf("an error occurred while checking existence of blob %s of %s:%s on %s: %v", blob, name, tag, m.dstURL, err)
 				return "", err
 			}
 			m.blobsExistence[blob] = exist
+			if exist {
+				m.indexBlob(blob)
+			}
 		}
 
 		if !exist {
@@ -349,20 +525,74 @@ func (m *ManifestPuller) enter() (string, error) {
 	}
 	m.logger.Infof("blobs of %s:%s need to be transferred to %s: %v", name, tag, m.dstURL, m.blobs)
 
+	var size int64
+	for _, blob := range m.blobs {
+		size += sizes[blob]
+	}
+	m.progress.AddBlobs(len(m.blobs), size)
+
 	return StateTransferBlob, nil
 }
 
-// BlobTransfer transfers blobs of a tag
+// pullManifest pulls the manifest of the reference from the source registry
+func (m *ManifestPuller) pullManifest(reference string) (distribution.Manifest, string, error) {
+	name := m.repository
+	acceptMediaTypes := []string{schema1.MediaTypeManifest, schema2.MediaTypeManifest, registry.MediaTypeManifestList}
+	digest, mediaType, payload, err := m.srcClient.PullManifest(reference, acceptMediaTypes)
+	if err != nil {
+		m.logger.Errorf("an error occurred while pulling manifest of %s:%s from %s: %v", name, reference, m.srcURL, err)
+		return nil, "", err
+	}
+	m.logger.Infof("manifest of %s:%s pulled successfully from %s: %s", name, reference, m.srcURL, digest)
+
+	if strings.Contains(mediaType, "application/json") {
+		mediaType = schema1.MediaTypeManifest
+	}
+
+	manifest, _, err := registry.UnMarshal(mediaType, payload)
+	if err != nil {
+		m.logger.Errorf("an error occurred while parsing manifest of %s:%s from %s: %v", name, reference, m.srcURL, err)
+		return nil, "", err
+	}
+
+	return manifest, digest, nil
+}
+
+// missingPlatforms returns the digests of the platform manifests referenced by the
+// manifest list which do not exist in the destination registry
+func (m *ManifestPuller) missingPlatforms(list *registry.ManifestList) ([]string, error) {
+	platforms := []string{}
+	for _, descriptor := range list.Manifests {
+		digest := descriptor.Digest.String()
+		_, exist, err := m.dstClient.ManifestExist(digest)
+		if err != nil {
+			m.logger.Errorf("an error occurred while checking existence of manifest %s of %s on %s: %v", digest, m.repository, m.dstURL, err)
+			return nil, err
+		}
+		if exist {
+			m.logger.Infof("manifest %s of %s for %s/%s already exists in %s", digest, m.repository,
+				descriptor.Platform.OS, descriptor.Platform.Architecture, m.dstURL)
+			continue
+		}
+		platforms = append(platforms, digest)
+	}
+	return platforms, nil
+}
+
+// BlobTransfer transfers blobs of a tag, a batch of as many blobs as the concurrency
+// is transferred concurrently each time it is entered, so the job can be stopped
+// between batches.
 type BlobTransfer struct {
 	*BaseHandler
 }
 
-// Enter pulls blobs and then pushs them to destination registry.
+// Enter pulls a batch of blobs and then pushs them to destination registry, the next
+// state is "transfer_blob" again until all blobs of the tag have been transferred.
 func (b *BlobTransfer) Enter() (string, error) {
 	state, err := b.enter()
 	if err != nil && retry(err) {
 		b.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
@@ -370,26 +600,170 @@ func (b *BlobTransfer) Enter() (string, error) {
 }
 
 func (b *BlobTransfer) enter() (string, error) {
+	if len(b.blobs) == 0 {
+		return StatePushManifest, nil
+	}
+
+	count := b.concurrency
+	if count < 1 {
+		count = 1
+	}
+	if count > len(b.blobs) {
+		count = len(b.blobs)
+	}
+	batch := b.blobs[:count]
+
+	errs := make([]error, len(batch))
+	wg := &sync.WaitGroup{}
+	for i, blob := range batch {
+		wg.Add(1)
+		go func(i int, blob, resume string) {
+			defer wg.Done()
+			errs[i] = b.transferBlob(blob, resume)
+		}(i, blob, b.takeResumeUpload(blob))
+	}
+	wg.Wait()
+
+	// the blobs failed to be transferred are kept to be transferred again, so are the
+	// ones canceled while waiting for free slots, the job is then stopped or drained
+	// by the state machine when this state is entered again
+	var err error
+	left := []string{}
+	for i, blob := range batch {
+		if errs[i] != nil {
+			left = append(left, blob)
+			if err == nil && errs[i] != errCanceled {
+				err = errs[i]
+			}
+		}
+	}
+	b.blobs = append(left, b.blobs[count:]...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b.blobs) > 0 {
+		return StateTransferBlob, nil
+	}
+	return StatePushManifest, nil
+}
+
+// transferBlob mounts the blob or pulls it and then pushs it to destination registry,
+// it waits for a free slot of the target before transferring. The chunked upload
+// resumes from location resume if it is not empty.
+func (b *BlobTransfer) transferBlob(blob, resume string) error {
 	name := b.repository
 	tag := b.tags[0]
-	for _, blob := range b.blobs {
-		b.logger.Infof("transferring blob %s of %s:%s to %s ...", blob, name, tag, b.dstURL)
+
+	release := limiter.acquire(b.target(), b.targetMaxTransfers, b.cancel)
+	if release == nil {
+		return errCanceled
+	}
+	defer release()
+
+	b.logger.Infof("transferring blob %s of %s:%s to %s ...", blob, name, tag, b.dstURL)
+	b.progress.StartBlob(blob)
+	if !b.mountBlob(blob) {
 		size, data, err := b.srcClient.PullBlob(blob)
 		if err != nil {
 			b.logger.Errorf("an error occurred while pulling blob %s of %s:%s from %s: %v", blob, name, tag, b.srcURL, err)
-			return "", err
+			return err
 		}
 		if data != nil {
 			defer data.Close()
 		}
-		if err = b.dstClient.PushBlob(blob, size, data); err != nil {
+		if err = b.pushBlob(blob, size, data, resume); err != nil {
 			b.logger.Errorf("an error occurred while pushing blob %s of %s:%s to %s : %v", blob, name, tag, b.dstURL, err)
-			return "", err
+			return err
 		}
-		b.logger.Infof("blob %s of %s:%s transferred to %s completed", blob, name, tag, b.dstURL)
 	}
+	b.indexBlob(blob)
+	b.progress.BlobDone(blob)
+	b.logger.Infof("blob %s of %s:%s transferred to %s completed", blob, name, tag, b.dstURL)
+	return nil
+}
 
-	return StatePushManifest, nil
+// takeResumeUpload returns the location of the upload of the blob left by the previous
+// attempt of the job, the location is only used once.
+func (b *BlobTransfer) takeResumeUpload(blob string) string {
+	if b.chunkSize <= 0 {
+		return ""
+	}
+	location := b.uploads[blob]
+	delete(b.uploads, blob)
+	return location
+}
+
+// mountBlob mounts the blob from the repository of the target in which the blob index
+// says it exists, it returns false if the blob needs to be pushed. The location is
+// removed from the index if the blob can not be mounted from it, as the blob may have
+// been deleted or the credential of the target can not pull from the repository.
+func (b *BlobTransfer) mountBlob(blob string) bool {
+	if b.targetID == 0 {
+		return false
+	}
+	location, err := dao.GetRepBlobLocation(b.targetID, blob)
+	if err != nil {
+		b.logger.Warningf("failed to get the location of blob %s on %s: %v", blob, b.dstURL, err)
+		return false
+	}
+	if location == nil || location.Repository == b.repository {
+		return false
+	}
+
+	mounted, err := b.dstClient.MountBlob(blob, location.Repository)
+	if err != nil {
+		b.logger.Warningf("an error occurred while mounting blob %s from %s on %s: %v", blob, location.Repository, b.dstURL, err)
+	}
+	if !mounted {
+		b.logger.Infof("blob %s can not be mounted from %s on %s, it will be pushed", blob, location.Repository, b.dstURL)
+		if err = dao.DeleteRepBlobLocation(b.targetID, blob); err != nil {
+			b.logger.Warningf("failed to delete the location of blob %s on %s: %v", blob, b.dstURL, err)
+		}
+		return false
+	}
+
+	b.logger.Infof("blob %s mounted from %s on %s", blob, location.Repository, b.dstURL)
+	return true
+}
+
+// pushBlob pushs the blob in chunks if the chunk size is set, the upload resumes from
+// location if it is not empty. The bytes the destination registry has received are
+// skipped from data before it is counted by the progress and throttled.
+func (b *BlobTransfer) pushBlob(blob string, size int64, data io.Reader, location string) error {
+	if b.chunkSize <= 0 {
+		return b.dstClient.PushBlob(blob, size, b.countAndThrottle(data))
+	}
+
+	var offset int64
+	if len(location) != 0 {
+		loc, off, err := b.dstClient.ResumeBlobUpload(location)
+		if err != nil {
+			return err
+		}
+		if len(loc) != 0 {
+			b.logger.Infof("resuming the upload of blob %s from %s at offset %d", blob, loc, off)
+			if _, err = io.CopyN(ioutil.Discard, data, off); err != nil {
+				return err
+			}
+		}
+		location, offset = loc, off
+	}
+
+	return b.dstClient.PushBlobChunked(blob, size, b.countAndThrottle(data), b.chunkSize, location, offset,
+		func(location string, offset int64) {
+			b.progress.SetUpload(blob, location, offset)
+		})
+}
+
+// countAndThrottle returns the reader of data whose bytes are counted by the progress
+// and throttled by the bandwidth limit of the target
+func (b *BlobTransfer) countAndThrottle(data io.Reader) io.Reader {
+	var reader io.Reader = io.TeeReader(data, b.progress)
+	if b.bandwidthLimit > 0 {
+		reader = throttle(b.target(), b.bandwidthLimit, reader)
+	}
+	return reader
 }
 
 // ManifestPusher pushs the manifest to destination registry
@@ -404,7 +778,7 @@ func (m *ManifestPusher) Enter() (string, error) {
 	state, err := m.enter()
 	if err != nil && retry(err) {
 		m.logger.Info("waiting for retrying...")
-		return models.JobRetrying, nil
+		return "", &RetryError{Err: err}
 	}
 
 	return state, err
@@ -414,24 +788,47 @@ func (m *ManifestPusher) Enter() (string, error) {
 func (m *ManifestPusher) enter() (string, error) {
 	name := m.repository
 	tag := m.tags[0]
-	_, exist, err := m.srcClient.ManifestExist(tag)
+
+	if m.list != nil {
+		if len(m.platforms) > 0 {
+			if err := m.pushPlatform(); err != nil {
+				return "", err
+			}
+			m.platforms = m.platforms[1:]
+			m.manifest = nil
+			m.digest = ""
+			m.blobs = nil
+			if len(m.platforms) > 0 {
+				return StatePullManifest, nil
+			}
+		}
+		// all the platform manifests are replicated, push the manifest list
+		m.manifest = m.list
+		m.digest = m.listDigest
+		m.list = nil
+		m.listDigest = ""
+	}
+
+	_, exist, err := m.srcClient.ManifestExist(m.reference())
 	if err != nil {
-		m.logger.Infof("an error occurred while checking the existence of manifest of %s:%s on %s: %v", name, tag, m.srcURL, err)
+		m.logger.Infof("an error occurred while checking the existence of manifest of %s:%s on %s: %v", name, m.reference(), m.srcURL, err)
 		return "", err
 	}
 	if !exist {
-		m.logger.Infof("manifest of %s:%s does not exist on source registry %s, cancel manifest pushing", name, tag, m.srcURL)
+		m.logger.Infof("manifest of %s:%s does not exist on source registry %s, cancel manifest pushing", name, m.reference(), m.srcURL)
 	} else {
 		m.logger.Infof("manifest of %s:%s exists on source registry %s, continue manifest pushing", name, tag, m.srcURL)
 
 		digest, manifestExist, err := m.dstClient.ManifestExist(tag)
 		if manifestExist && digest == m.digest {
 			m.logger.Infof("manifest of %s:%s exists on destination registry %s, skip manifest pushing", name, tag, m.dstURL)
+			m.recordDigest(m.digest)
 
 			m.tags = m.tags[1:]
 			m.manifest = nil
 			m.digest = ""
 			m.blobs = nil
+			m.progress.TagDone()
 
 			return StatePullManifest, nil
 		}
@@ -447,22 +844,42 @@ func (m *ManifestPusher) enter() (string, error) {
 			return "", err
 		}
 		m.logger.Infof("manifest of %s:%s has been pushed to %s", name, tag, m.dstURL)
+		m.recordDigest(m.digest)
 	}
 
 	m.tags = m.tags[1:]
 	m.manifest = nil
 	m.digest = ""
 	m.blobs = nil
+	m.progress.TagDone()
 
 	return StatePullManifest, nil
 }
 
-func newRepositoryClient(endpoint string, insecure bool, credential auth.Credential, repository, scopeType, scopeName string,
+// pushPlatform pushs the manifest of platforms[0] by its digest
+func (m *ManifestPusher) pushPlatform() error {
+	name := m.repository
+	digest := m.platforms[0]
+	mediaType, data, err := m.manifest.Payload()
+	if err != nil {
+		m.logger.Errorf("an error occurred while getting payload of manifest %s of %s : %v", digest, name, err)
+		return err
+	}
+
+	if _, err = m.dstClient.PushManifest(digest, mediaType, data); err != nil {
+		m.logger.Errorf("an error occurred while pushing manifest %s of %s to %s : %v", digest, name, m.dstURL, err)
+		return err
+	}
+	m.logger.Infof("manifest %s of %s has been pushed to %s", digest, name, m.dstURL)
+	return nil
+}
+
+func newRepositoryClient(endpoint string, transport http.RoundTripper, credential auth.Credential, repository, scopeType, scopeName string,
 	scopeActions ...string) (*registry.Repository, error) {
 
-	authorizer := auth.NewStandardTokenAuthorizer(credential, insecure, scopeType, scopeName, scopeActions...)
+	authorizer := auth.NewStandardTokenAuthorizerWithTransport(credential, transport, scopeType, scopeName, scopeActions...)
 
-	store, err := auth.NewAuthorizerStore(endpoint, insecure, authorizer)
+	store, err := auth.NewAuthorizerStoreWithTransport(endpoint, transport, authorizer)
 	if err != nil {
 		return nil, err
 	}
@@ -471,7 +888,7 @@ func newRepositoryClient(endpoint string, insecure bool, credential auth.Credent
 		userAgent: "harbor-registry-client",
 	}
 
-	client, err := registry.NewRepositoryWithModifiers(repository, endpoint, insecure, store, uam)
+	client, err := registry.NewRepositoryWithTransport(repository, endpoint, transport, store, uam)
 	if err != nil {
 		return nil, err
 	}
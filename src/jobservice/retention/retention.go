@@ -0,0 +1,194 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package retention
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/config"
+	"github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// the interval at which the retention policy is enforced
+const purgeInterval = time.Hour
+
+// the count of jobs purged at a time
+var batchSize = 1000
+
+// Policy defines which completed jobs are retained
+type Policy struct {
+	// MaxAge is the age after which the finished, stopped and canceled jobs are removed, 0 means forever
+	MaxAge time.Duration
+	// MaxErrorAge is the age after which the failed jobs are removed, 0 means forever
+	MaxErrorAge time.Duration
+	// MaxCount is the count of finished, stopped and canceled jobs retained for each policy, 0 means no limit
+	MaxCount int
+}
+
+// Result reports the jobs and log files removed by a purge
+type Result struct {
+	DryRun   bool    `json:"dry_run"`
+	JobIDs   []int64 `json:"job_ids"`
+	LogFiles int     `json:"log_files"`
+	LogBytes int64   `json:"log_bytes"`
+}
+
+// avoid purges running at the same time
+var lock sync.Mutex
+
+// DefaultPolicy returns the retention policy in configuration
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAge:      time.Duration(config.JobRetentionDays()) * 24 * time.Hour,
+		MaxErrorAge: time.Duration(config.JobErrorRetentionDays()) * 24 * time.Hour,
+		MaxCount:    config.JobRetentionCount(),
+	}
+}
+
+// Start enforces the default retention policy periodically
+func Start() {
+	go func() {
+		for {
+			if r, err := Purge(DefaultPolicy(), false); err != nil {
+				log.Errorf("Failed to purge replication jobs, error: %v", err)
+			} else if len(r.JobIDs) > 0 {
+				log.Infof("%d replication jobs and %d log files have been purged", len(r.JobIDs), r.LogFiles)
+			}
+			time.Sleep(purgeInterval)
+		}
+	}()
+}
+
+// Purge removes the jobs and their log files which are not retained by the policy,
+// if dryRun is true, it only reports what would be removed. The jobs are purged in
+// batches, the log files of a batch are removed after the rows of the batch.
+func Purge(p Policy, dryRun bool) (*Result, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := &Result{
+		DryRun: dryRun,
+		JobIDs: []int64{},
+	}
+	// a job may be selected by several rules, it is only purged once
+	purged := map[int64]struct{}{}
+	err := forEachBatchToPurge(p, time.Now(), func(ids []int64) error {
+		batch := []int64{}
+		for _, id := range ids {
+			if _, ok := purged[id]; !ok {
+				purged[id] = struct{}{}
+				batch = append(batch, id)
+			}
+		}
+		// the rows are deleted before the log files, so a job whose row fails to be
+		// deleted keeps its log
+		if !dryRun {
+			if _, err := dao.DeleteRepJobs(batch...); err != nil {
+				return err
+			}
+		}
+		result.JobIDs = append(result.JobIDs, batch...)
+		removeLogs(batch, dryRun, result)
+		return nil
+	})
+	return result, err
+}
+
+// removeLogs removes the log files of the jobs and adds them to the result
+func removeLogs(ids []int64, dryRun bool, result *Result) {
+	for _, id := range ids {
+		info, err := os.Stat(utils.GetJobLogPath(id))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Warningf("Failed to get the info of log file of job %d, error: %v", id, err)
+			}
+			continue
+		}
+		if !dryRun {
+			if err = os.Remove(utils.GetJobLogPath(id)); err != nil {
+				log.Warningf("Failed to remove the log file of job %d, error: %v", id, err)
+				continue
+			}
+		}
+		result.LogFiles++
+		result.LogBytes += info.Size()
+	}
+}
+
+// forEachBatchToPurge calls handle with the IDs of jobs which are not retained by the
+// policy at now, batchSize IDs at a time
+func forEachBatchToPurge(p Policy, now time.Time, handle func(ids []int64) error) error {
+	completed := []string{models.JobFinished, models.JobStopped, models.JobCanceled}
+
+	if p.MaxAge > 0 {
+		if err := forEachBatch(func(afterID int64, limit int) ([]int64, error) {
+			return dao.GetExpiredRepJobIDs(now.Add(-p.MaxAge), afterID, limit, completed...)
+		}, handle); err != nil {
+			return err
+		}
+	}
+
+	if p.MaxErrorAge > 0 {
+		if err := forEachBatch(func(afterID int64, limit int) ([]int64, error) {
+			return dao.GetExpiredRepJobIDs(now.Add(-p.MaxErrorAge), afterID, limit, models.JobError)
+		}, handle); err != nil {
+			return err
+		}
+	}
+
+	if p.MaxCount > 0 {
+		policyIDs, err := dao.GetRepJobPolicyIDs()
+		if err != nil {
+			return err
+		}
+		for _, policyID := range policyIDs {
+			policyID := policyID
+			if err = forEachBatch(func(afterID int64, limit int) ([]int64, error) {
+				return dao.GetExcessRepJobIDs(policyID, p.MaxCount, afterID, limit, completed...)
+			}, handle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forEachBatch pages through the IDs returned by list in ascending order, and calls
+// handle with each page of batchSize IDs at most
+func forEachBatch(list func(afterID int64, limit int) ([]int64, error), handle func(ids []int64) error) error {
+	var afterID int64
+	for {
+		ids, err := list(afterID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err = handle(ids); err != nil {
+			return err
+		}
+		if len(ids) < batchSize {
+			return nil
+		}
+		afterID = ids[len(ids)-1]
+	}
+}
@@ -0,0 +1,62 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package retention
+
+import (
+	"testing"
+)
+
+func TestForEachBatch(t *testing.T) {
+	defer func(size int) {
+		batchSize = size
+	}(batchSize)
+	batchSize = 2
+
+	all := []int64{1, 3, 4, 7, 8}
+	list := func(afterID int64, limit int) ([]int64, error) {
+		ids := []int64{}
+		for _, id := range all {
+			if id > afterID && len(ids) < limit {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	batches := [][]int64{}
+	if err := forEachBatch(list, func(ids []int64) error {
+		batches = append(batches, ids)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to page through the IDs: %v", err)
+	}
+
+	if len(batches) != 3 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+	seen := []int64{}
+	for _, batch := range batches {
+		if len(batch) > batchSize {
+			t.Errorf("batch %v is larger than %d", batch, batchSize)
+		}
+		seen = append(seen, batch...)
+	}
+	for i, id := range all {
+		if i >= len(seen) || seen[i] != id {
+			t.Fatalf("unexpected IDs: %v != %v", seen, all)
+		}
+	}
+}
@@ -23,6 +23,12 @@ import (
 
 func initRouters() {
 	beego.Router("/api/jobs/replication", &api.ReplicationJob{})
-	beego.Router("/api/jobs/replication/:id/log", &api.ReplicationJob{}, "get:GetLog")
 	beego.Router("/api/jobs/replication/actions", &api.ReplicationJob{}, "post:HandleAction")
+	beego.Router("/api/jobs/replication/purge", &api.ReplicationJob{}, "post:Purge")
+	beego.Router("/api/jobs/replication/reconcile", &api.ReplicationJob{}, "post:Reconcile")
+	beego.Router("/api/jobs/replication/executions/:id([0-9]+)/retry", &api.ReplicationJob{}, "post:RetryExecution")
+	beego.Router("/api/jobs/:kind/:id([0-9]+)/status", &api.Job{}, "get:GetStatus")
+	beego.Router("/api/jobs/:kind/:id([0-9]+)/log", &api.Job{}, "get:GetLog")
+	beego.Router("/api/jobs/:kind/:id([0-9]+)/actions", &api.Job{}, "post:HandleAction")
+	beego.Router("/metrics", &api.Metrics{})
 }
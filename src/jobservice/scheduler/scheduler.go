@@ -0,0 +1,265 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/jobservice/job"
+	jobutils "github.com/vmware/harbor/src/jobservice/utils"
+)
+
+// the interval at which the policies are reloaded from DB, so that the
+// changes which are not notified to the scheduler can also take effect
+const reloadInterval = 5 * time.Minute
+
+type entry struct {
+	cronStr   string
+	startTime time.Time
+	next      time.Time
+}
+
+// PolicyScheduler triggers the replication of the policies which have cron
+// string periodically.
+type PolicyScheduler struct {
+	entries map[int64]*entry
+	lock    sync.Mutex
+	changed chan struct{}
+}
+
+// DefaultScheduler is the scheduler used by job service
+var DefaultScheduler = NewPolicyScheduler()
+
+// NewPolicyScheduler returns an instance of PolicyScheduler
+func NewPolicyScheduler() *PolicyScheduler {
+	return &PolicyScheduler{
+		entries: make(map[int64]*entry),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Start loads all the scheduled policies from DB and triggers the replication when they are due.
+func (s *PolicyScheduler) Start() {
+	s.reload()
+	go s.run()
+}
+
+// Reschedule reloads the policy from DB and recalculates the next run time, it should be called
+// when the policy is added, updated, enabled, disabled or deleted.
+func (s *PolicyScheduler) Reschedule(policyID int64) error {
+	policy, err := dao.GetRepPolicy(policyID)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if policy == nil || policy.Deleted == 1 || policy.Enabled == 0 || len(policy.CronStr) == 0 {
+		s.unschedule(policyID)
+	} else {
+		s.schedule(policy, time.Now())
+	}
+	s.lock.Unlock()
+
+	s.notify()
+	return nil
+}
+
+// NextRunTime returns the next time when the replication of the policy will be triggered,
+// the second return value is false if the policy is not scheduled.
+func (s *PolicyScheduler) NextRunTime(policyID int64) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[policyID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.next, true
+}
+
+// schedule must be called with the lock held
+func (s *PolicyScheduler) schedule(policy *models.RepPolicy, now time.Time) {
+	e, ok := s.entries[policy.ID]
+	if ok && e.cronStr == policy.CronStr && e.startTime.Equal(policy.StartTime) {
+		return
+	}
+
+	next, err := utils.NextRunTime(policy.CronStr, policy.StartTime, now)
+	if err != nil {
+		log.Errorf("failed to schedule policy %d with cron string %s: %v", policy.ID, policy.CronStr, err)
+		s.unschedule(policy.ID)
+		return
+	}
+
+	s.entries[policy.ID] = &entry{
+		cronStr:   policy.CronStr,
+		startTime: policy.StartTime,
+		next:      next,
+	}
+	recordNextRunTime(policy.ID, next)
+	log.Debugf("policy %d is scheduled, next run time: %v", policy.ID, next)
+}
+
+// unschedule must be called with the lock held
+func (s *PolicyScheduler) unschedule(policyID int64) {
+	delete(s.entries, policyID)
+	recordNextRunTime(policyID, time.Time{})
+	log.Debugf("policy %d is unscheduled", policyID)
+}
+
+// recordNextRunTime records the next run time of the policy in DB, so the UI shows
+// the time when the scheduler triggers the replication rather than calculating it
+func recordNextRunTime(policyID int64, next time.Time) {
+	if err := dao.UpdateRepPolicyNextRunTime(policyID, next); err != nil {
+		log.Errorf("failed to record the next run time of policy %d: %v", policyID, err)
+	}
+}
+
+func (s *PolicyScheduler) reload() {
+	policies, err := dao.GetScheduledRepPolicies()
+	if err != nil {
+		log.Errorf("failed to get scheduled policies: %v", err)
+		return
+	}
+
+	now := time.Now()
+	scheduled := make(map[int64]struct{}, len(policies))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, policy := range policies {
+		scheduled[policy.ID] = struct{}{}
+		s.schedule(policy, now)
+	}
+	for id := range s.entries {
+		if _, ok := scheduled[id]; !ok {
+			s.unschedule(id)
+		}
+	}
+}
+
+func (s *PolicyScheduler) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *PolicyScheduler) run() {
+	reload := time.NewTicker(reloadInterval)
+	defer reload.Stop()
+	for {
+		timer := time.NewTimer(s.wait(time.Now()))
+		select {
+		case <-timer.C:
+			s.triggerDue(time.Now())
+		case <-s.changed:
+		case <-reload.C:
+			s.reload()
+		}
+		timer.Stop()
+	}
+}
+
+// wait returns the duration before the earliest next run time
+func (s *PolicyScheduler) wait(now time.Time) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	d := reloadInterval
+	for _, e := range s.entries {
+		if e.next.Sub(now) < d {
+			d = e.next.Sub(now)
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+func (s *PolicyScheduler) triggerDue(now time.Time) {
+	var due []int64
+	s.lock.Lock()
+	for id, e := range s.entries {
+		if e.next.After(now) {
+			continue
+		}
+		due = append(due, id)
+		next, err := utils.NextRunTime(e.cronStr, e.startTime, now)
+		if err != nil {
+			log.Errorf("failed to calculate the next run time of policy %d: %v", id, err)
+			s.unschedule(id)
+			continue
+		}
+		e.next = next
+		recordNextRunTime(id, next)
+	}
+	s.lock.Unlock()
+
+	for _, id := range due {
+		go func(policyID int64) {
+			if err := Replicate(policyID); err != nil {
+				log.Errorf("failed to trigger the scheduled replication of policy %d: %v", policyID, err)
+				return
+			}
+			log.Infof("the scheduled replication of policy %d triggered", policyID)
+		}(id)
+	}
+}
+
+// Replicate creates jobs for all the repositories the policy replicates in an
+// execution triggered by the schedule and sends them to the job queue, the jobs
+// transfer the repositories to the target for push policies and from the target
+// for pull policies.
+func Replicate(policyID int64) error {
+	policy, err := dao.GetRepPolicy(policyID)
+	if err != nil {
+		return err
+	}
+	if policy == nil || policy.Deleted == 1 || policy.Enabled == 0 {
+		log.Debugf("policy %d does not exist or is disabled, skip the replication", policyID)
+		return nil
+	}
+
+	repositories, err := jobutils.GetPolicyRepoList(policy)
+	if err != nil {
+		return err
+	}
+
+	operation := models.RepOpTransfer
+	if policy.Direction == models.RepDirectionPull {
+		operation = models.RepOpPull
+	}
+	execution := job.NewExecution(policyID, models.RepTriggerSchedule)
+	defer execution.Close()
+	for _, repository := range repositories {
+		if !policy.MatchRepository(repository) {
+			continue
+		}
+		err := execution.AddJob(models.RepJob{
+			Repository: repository,
+			Operation:  operation,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
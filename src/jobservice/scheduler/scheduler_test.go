@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	s := NewPolicyScheduler()
+	now := time.Now()
+	if d := s.wait(now); d != reloadInterval {
+		t.Errorf("unexpected duration: %v != %v", d, reloadInterval)
+	}
+
+	s.entries[1] = &entry{next: now.Add(time.Minute)}
+	s.entries[2] = &entry{next: now.Add(2 * time.Minute)}
+	if d := s.wait(now); d != time.Minute {
+		t.Errorf("unexpected duration: %v != %v", d, time.Minute)
+	}
+
+	s.entries[3] = &entry{next: now.Add(-time.Minute)}
+	if d := s.wait(now); d != 0 {
+		t.Errorf("unexpected duration: %v != %v", d, 0)
+	}
+}
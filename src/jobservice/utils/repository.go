@@ -0,0 +1,160 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/log"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/common/utils/registry/auth"
+	"github.com/vmware/harbor/src/jobservice/config"
+)
+
+// GetRepoList calls the api from UI to get repo list of a project
+func GetRepoList(projectID int64) ([]string, error) {
+	repositories := []string{}
+
+	client := &http.Client{}
+	uiURL := config.LocalUIURL()
+	next := "/api/repositories?project_id=" + strconv.Itoa(int(projectID))
+	for len(next) != 0 {
+		req, err := http.NewRequest("GET", uiURL+next, nil)
+		if err != nil {
+			return repositories, err
+		}
+
+		req.AddCookie(&http.Cookie{Name: models.UISecretCookie, Value: config.UISecret()})
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return repositories, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			dump, _ := httputil.DumpResponse(resp, true)
+			log.Debugf("response: %q", dump)
+			return repositories, fmt.Errorf("Unexpected status code when getting repository list: %d", resp.StatusCode)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return repositories, err
+		}
+
+		var list []string
+		if err = json.Unmarshal(body, &list); err != nil {
+			return repositories, err
+		}
+
+		repositories = append(repositories, list...)
+
+		links := utils.ParseLink(resp.Header.Get(http.CanonicalHeaderKey("link")))
+		next = links.Next()
+	}
+
+	return repositories, nil
+}
+
+// GetPolicyRepoList returns the repositories the policy replicates, they are the repositories
+// of the local project for push policies, and the repositories of the project with the same
+// name on the target for pull policies
+func GetPolicyRepoList(policy *models.RepPolicy) ([]string, error) {
+	if policy.Direction != models.RepDirectionPull {
+		return GetRepoList(policy.ProjectID)
+	}
+	return getTargetRepoList(policy)
+}
+
+// GetPolicyDstRepoList returns the repositories in the destination of the policy, they are
+// the repositories of the project with the same name on the target for push policies, and
+// the repositories of the local project for pull policies
+func GetPolicyDstRepoList(policy *models.RepPolicy) ([]string, error) {
+	if policy.Direction == models.RepDirectionPull {
+		return GetRepoList(policy.ProjectID)
+	}
+	return getTargetRepoList(policy)
+}
+
+// getTargetRepoList returns the repositories of the project with the same name as the
+// project of the policy on the target
+func getTargetRepoList(policy *models.RepPolicy) ([]string, error) {
+	project, err := dao.GetProjectByID(policy.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project %d not found", policy.ProjectID)
+	}
+
+	target, err := dao.GetRepTarget(policy.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("target %d not found", policy.TargetID)
+	}
+
+	pwd, transportConfig, err := TargetCredential(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetRemoteRepoList(target.URL, target.Username, pwd, project.Name, transportConfig)
+}
+
+// GetRemoteRepoList calls the catalog api of a remote registry to get repo list of a project
+func GetRemoteRepoList(endpoint, username, password, project string, transportConfig *registry.TransportConfig) ([]string, error) {
+	transport, err := registry.GetTransport(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := auth.NewBasicAuthCredential(username, password)
+	authorizer := auth.NewStandardTokenAuthorizerWithTransport(credential, transport, "registry", "catalog", "*")
+	store, err := auth.NewAuthorizerStoreWithTransport(endpoint, transport, authorizer)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := registry.NewRegistryWithTransport(endpoint, transport, store)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := client.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := []string{}
+	for _, repo := range repos {
+		if strings.HasPrefix(repo, project+"/") {
+			repositories = append(repositories, repo)
+		}
+	}
+	return repositories, nil
+}
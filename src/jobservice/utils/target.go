@@ -0,0 +1,58 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils"
+	"github.com/vmware/harbor/src/common/utils/registry"
+	"github.com/vmware/harbor/src/jobservice/config"
+)
+
+// TargetCredential returns the password of the target and the TLS and proxy settings
+// to connect to it, the secrets stored encrypted in DB are decrypted
+func TargetCredential(target *models.RepTarget) (string, *registry.TransportConfig, error) {
+	secrets := map[string]string{
+		"password":       target.Password,
+		"client key":     target.ClientKey,
+		"proxy password": target.ProxyPassword,
+	}
+	for name, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		str, err := utils.ReversibleDecrypt(secret, config.SecretKey())
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decrypt %s: %v", name, err)
+		}
+		secrets[name] = str
+	}
+
+	return secrets["password"], &registry.TransportConfig{
+		Insecure:      target.Insecure || !config.VerifyRemoteCert(),
+		CACert:        target.CACert,
+		ClientCert:    target.ClientCert,
+		ClientKey:     secrets["client key"],
+		ProxyURL:      target.ProxyURL,
+		ProxyUsername: target.ProxyUsername,
+		ProxyPassword: secrets["proxy password"],
+		NoProxy:       target.NoProxy,
+		TargetID:      target.ID,
+		UpdateTime:    target.UpdateTime,
+	}, nil
+}
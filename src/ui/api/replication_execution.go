@@ -0,0 +1,116 @@
+/*
+   Copyright (c) 2016 VMware, Inc. All Rights Reserved.
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vmware/harbor/src/common/api"
+	"github.com/vmware/harbor/src/common/dao"
+	"github.com/vmware/harbor/src/common/models"
+	"github.com/vmware/harbor/src/common/utils/log"
+)
+
+// RepExecutionAPI handles request to /api/jobs/replication/executions
+// /api/jobs/replication/executions/:id /api/jobs/replication/executions/:id/retry,
+// the jobs of an execution are listed by /api/jobs/replication?execution_id=
+type RepExecutionAPI struct {
+	api.BaseAPI
+	execution *models.RepExecution
+}
+
+// Prepare validates that whether user has system admin role, and gets
+// the execution if its ID is in the URL
+func (ra *RepExecutionAPI) Prepare() {
+	uid := ra.ValidateUser()
+	isAdmin, err := dao.IsAdminRole(uid)
+	if err != nil {
+		log.Errorf("Failed to Check if the user is admin, error: %v, uid: %d", err, uid)
+	}
+	if !isAdmin {
+		ra.CustomAbort(http.StatusForbidden, "")
+	}
+
+	idStr := ra.Ctx.Input.Param(":id")
+	if len(idStr) == 0 {
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ra.CustomAbort(http.StatusBadRequest, "ID is invalid")
+	}
+	execution, err := dao.GetRepExecution(id)
+	if err != nil {
+		log.Errorf("failed to get execution %d: %v", id, err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	if execution == nil {
+		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("execution %d not found", id))
+	}
+	ra.execution = execution
+}
+
+// Get returns the execution with the counts of its jobs
+func (ra *RepExecutionAPI) Get() {
+	ra.Data["json"] = ra.execution
+	ra.ServeJSON()
+}
+
+// List returns the executions of the policy, the latest first
+func (ra *RepExecutionAPI) List() {
+	policyID, err := ra.GetInt64("policy_id")
+	if err != nil || policyID <= 0 {
+		ra.CustomAbort(http.StatusBadRequest, "invalid policy_id")
+	}
+
+	policy, err := dao.GetRepPolicy(policyID)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", policyID, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if policy == nil {
+		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("policy %d not found", policyID))
+	}
+
+	page, pageSize := ra.GetPaginationParams()
+
+	executions, total, err := dao.FilterRepExecutions(policyID, pageSize, pageSize*(page-1))
+	if err != nil {
+		log.Errorf("failed to filter executions of policy %d: %v", policyID, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	ra.SetPaginationHeader(total, page, pageSize)
+
+	ra.Data["json"] = executions
+	ra.ServeJSON()
+}
+
+// Retry puts the failed jobs of the execution back to the job queue
+func (ra *RepExecutionAPI) Retry() {
+	code, message, err := postExecutionRetry(ra.execution.ID)
+	if err != nil {
+		log.Errorf("failed to retry execution %d: %v", ra.execution.ID, err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if code != http.StatusOK {
+		ra.CustomAbort(code, message)
+	}
+}
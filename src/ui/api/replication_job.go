@@ -20,6 +20,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -75,6 +76,11 @@ func (ra *RepJobAPI) List() {
 		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("policy %d not found", policyID))
 	}
 
+	executionID, err := ra.GetInt64("execution_id", 0)
+	if err != nil || executionID < 0 {
+		ra.CustomAbort(http.StatusBadRequest, "invalid execution_id")
+	}
+
 	repository := ra.GetString("repository")
 	status := ra.GetString("status")
 
@@ -102,11 +108,16 @@ func (ra *RepJobAPI) List() {
 
 	page, pageSize := ra.GetPaginationParams()
 
-	jobs, total, err := dao.FilterRepJobs(policyID, repository, status,
+	jobs, total, err := dao.FilterRepJobs(policyID, executionID, repository, status,
 		startTime, endTime, pageSize, pageSize*(page-1))
 	if err != nil {
-		log.Errorf("failed to filter jobs according policy ID %d, repository %s, status %s, start time %v, end time %v: %v",
-			policyID, repository, status, startTime, endTime, err)
+		log.Errorf("failed to filter jobs according policy ID %d, execution ID %d, repository %s, status %s, start time %v, end time %v: %v",
+			policyID, executionID, repository, status, startTime, endTime, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+
+	if err = setAttempts(jobs); err != nil {
+		log.Errorf("failed to get attempts of jobs: %v", err)
 		ra.CustomAbort(http.StatusInternalServerError, "")
 	}
 
@@ -116,6 +127,30 @@ func (ra *RepJobAPI) List() {
 	ra.ServeJSON()
 }
 
+// setAttempts populates the failed attempts of the jobs which have ever failed
+func setAttempts(jobs []*models.RepJob) error {
+	ids := []int64{}
+	for _, job := range jobs {
+		if job.RetryCount > 0 || job.Status == models.JobError {
+			ids = append(ids, job.ID)
+		}
+	}
+
+	attempts, err := dao.GetRepJobAttempts(ids...)
+	if err != nil {
+		return err
+	}
+
+	m := map[int64][]*models.RepJobAttempt{}
+	for _, attempt := range attempts {
+		m[attempt.JobID] = append(m[attempt.JobID], attempt)
+	}
+	for _, job := range jobs {
+		job.Attempts = m[job.ID]
+	}
+	return nil
+}
+
 // Delete ...
 func (ra *RepJobAPI) Delete() {
 	if ra.jobID == 0 {
@@ -142,13 +177,100 @@ func (ra *RepJobAPI) Delete() {
 	}
 }
 
-// GetLog ...
+// Purge calls job service to remove the completed jobs and their logs which
+// are not retained by the retention policy, and returns what has been removed
+func (ra *RepJobAPI) Purge() {
+	purgeURL := buildJobPurgeURL()
+	if dryRun := ra.GetString("dry_run"); len(dryRun) != 0 {
+		purgeURL += "?" + url.Values{"dry_run": []string{dryRun}}.Encode()
+	}
+
+	req, err := http.NewRequest("POST", purgeURL, nil)
+	if err != nil {
+		log.Errorf("failed to create a request: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+	addAuthentication(req)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("failed to purge jobs: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("failed to read reponse body: %v", err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		ra.CustomAbort(resp.StatusCode, string(b))
+	}
+
+	ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	if _, err = ra.Ctx.ResponseWriter.Write(b); err != nil {
+		log.Errorf("failed to write response: %v", err)
+	}
+}
+
+// Put handles the actions to a job: "stop" a running job, "cancel" a pending
+// or retrying job, and "rerun" a completed job
+func (ra *RepJobAPI) Put() {
+	if ra.jobID == 0 {
+		ra.CustomAbort(http.StatusBadRequest, "id is nil")
+	}
+
+	req := struct {
+		Action string `json:"action"`
+	}{}
+	ra.DecodeJSONReq(&req)
+	if req.Action != "stop" && req.Action != "cancel" && req.Action != "rerun" {
+		ra.CustomAbort(http.StatusBadRequest, fmt.Sprintf("invalid action: %s", req.Action))
+	}
+
+	job, err := dao.GetRepJob(ra.jobID)
+	if err != nil {
+		log.Errorf("failed to get job %d: %v", ra.jobID, err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if job == nil {
+		ra.CustomAbort(http.StatusNotFound, fmt.Sprintf("job %d not found", ra.jobID))
+	}
+
+	code, message, err := postJobAction(ra.jobID, req.Action)
+	if err != nil {
+		log.Errorf("failed to %s job %d: %v", req.Action, ra.jobID, err)
+		ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if code != http.StatusOK {
+		ra.CustomAbort(code, message)
+	}
+}
+
+// GetLog gets the log of the job from job service, the parameters "offset" and
+// "follow" are passed through to job service to read the log from a byte offset
+// and stream the log as it is written.
 func (ra *RepJobAPI) GetLog() {
 	if ra.jobID == 0 {
 		ra.CustomAbort(http.StatusBadRequest, "id is nil")
 	}
 
-	req, err := http.NewRequest("GET", buildJobLogURL(strconv.FormatInt(ra.jobID, 10)), nil)
+	params := url.Values{}
+	for _, key := range []string{"offset", "follow"} {
+		if v := ra.GetString(key); len(v) != 0 {
+			params.Set(key, v)
+		}
+	}
+	logURL := buildJobLogURL(strconv.FormatInt(ra.jobID, 10))
+	if len(params) != 0 {
+		logURL += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest("GET", logURL, nil)
 	if err != nil {
 		log.Errorf("failed to create a request: %v", err)
 		ra.CustomAbort(http.StatusInternalServerError, "")
@@ -162,14 +284,42 @@ func (ra *RepJobAPI) GetLog() {
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusOK {
-		ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Length"), resp.Header.Get(http.CanonicalHeaderKey("Content-Length")))
+		for _, key := range []string{"Content-Length", "X-Log-Offset"} {
+			if v := resp.Header.Get(http.CanonicalHeaderKey(key)); len(v) != 0 {
+				ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey(key), v)
+			}
+		}
 		ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "text/plain")
+		// the offset is sent in the trailer when the log is followed
+		_, trailer := resp.Trailer[http.CanonicalHeaderKey("X-Log-Offset")]
+		if trailer {
+			ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Trailer"), "X-Log-Offset")
+		}
 
-		if _, err = io.Copy(ra.Ctx.ResponseWriter, resp.Body); err != nil {
-			log.Errorf("failed to write log to response; %v", err)
-			ra.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		// flush the response every time the log is read, so the log
+		// is delivered to the client as it is streamed by job service
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := resp.Body.Read(buf)
+			if n > 0 {
+				if _, e := ra.Ctx.ResponseWriter.Write(buf[:n]); e != nil {
+					log.Errorf("failed to write log to response; %v", e)
+					return
+				}
+				ra.Ctx.ResponseWriter.Flush()
+			}
+			if err == io.EOF {
+				if trailer {
+					ra.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("X-Log-Offset"),
+						resp.Trailer.Get(http.CanonicalHeaderKey("X-Log-Offset")))
+				}
+				return
+			}
+			if err != nil {
+				log.Errorf("failed to read log of job %d: %v", ra.jobID, err)
+				return
+			}
 		}
-		return
 	}
 
 	b, err := ioutil.ReadAll(resp.Body)
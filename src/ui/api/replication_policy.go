@@ -16,10 +16,15 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 
+	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/vmware/harbor/src/common/dao"
 	"github.com/vmware/harbor/src/common/models"
@@ -27,6 +32,9 @@ import (
     "github.com/vmware/harbor/src/common/api"
 )
 
+// reconcileTimeout is the time job service is given to compare the repositories of a policy
+const reconcileTimeout = 5 * time.Minute
+
 // RepPolicyAPI handles /api/replicationPolicies /api/replicationPolicies/:id/enablement
 type RepPolicyAPI struct {
 	api.BaseAPI
@@ -58,6 +66,8 @@ func (pa *RepPolicyAPI) Get() {
 		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
 	}
 
+	setNextRunTime(policy)
+
 	pa.Data["json"] = policy
 	pa.ServeJSON()
 }
@@ -83,6 +93,8 @@ func (pa *RepPolicyAPI) List() {
 		log.Errorf("failed to filter policies %s project ID %d: %v", name, projectID, err)
 		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
+	setNextRunTime(policies...)
+
 	pa.Data["json"] = policies
 	pa.ServeJSON()
 }
@@ -143,7 +155,7 @@ func (pa *RepPolicyAPI) Post() {
 
 	if policy.Enabled == 1 {
 		go func() {
-			if err := TriggerReplication(pid, "", nil, models.RepOpTransfer); err != nil {
+			if err := TriggerReplication(pid, "", nil, "", models.RepOpTransfer, models.RepTriggerManual); err != nil {
 				log.Errorf("failed to trigger replication of %d: %v", pid, err)
 			} else {
 				log.Infof("replication of %d triggered", pid)
@@ -151,6 +163,10 @@ func (pa *RepPolicyAPI) Post() {
 		}()
 	}
 
+	if len(policy.CronStr) != 0 {
+		go reschedule(pid)
+	}
+
 	pa.Redirect(http.StatusCreated, strconv.FormatInt(pid, 10))
 }
 
@@ -170,6 +186,7 @@ func (pa *RepPolicyAPI) Put() {
 	policy := &models.RepPolicy{}
 	pa.DecodeJSONReq(policy)
 	policy.ProjectID = originalPolicy.ProjectID
+	policy.Direction = originalPolicy.Direction
 	pa.Validate(policy)
 
 	/*
@@ -218,6 +235,10 @@ func (pa *RepPolicyAPI) Put() {
 
 	policy.ID = id
 
+	if policy.StartTime.IsZero() {
+		policy.StartTime = originalPolicy.StartTime
+	}
+
 	/*
 		isTargetChanged := !(policy.TargetID == originalPolicy.TargetID)
 		isEnablementChanged := !(policy.Enabled == policy.Enabled)
@@ -293,13 +314,15 @@ func (pa *RepPolicyAPI) Put() {
 
 	if policy.Enabled != originalPolicy.Enabled && policy.Enabled == 1 {
 		go func() {
-			if err := TriggerReplication(id, "", nil, models.RepOpTransfer); err != nil {
+			if err := TriggerReplication(id, "", nil, "", models.RepOpTransfer, models.RepTriggerManual); err != nil {
 				log.Errorf("failed to trigger replication of %d: %v", id, err)
 			} else {
 				log.Infof("replication of %d triggered", id)
 			}
 		}()
 	}
+
+	go reschedule(id)
 }
 
 type enablementReq struct {
@@ -338,7 +361,7 @@ func (pa *RepPolicyAPI) UpdateEnablement() {
 
 	if e.Enabled == 1 {
 		go func() {
-			if err := TriggerReplication(id, "", nil, models.RepOpTransfer); err != nil {
+			if err := TriggerReplication(id, "", nil, "", models.RepOpTransfer, models.RepTriggerManual); err != nil {
 				log.Errorf("failed to trigger replication of %d: %v", id, err)
 			} else {
 				log.Infof("replication of %d triggered", id)
@@ -353,6 +376,75 @@ func (pa *RepPolicyAPI) UpdateEnablement() {
 			}
 		}()
 	}
+
+	go reschedule(id)
+}
+
+// Reconcile calls job service to compare the tags of the repositories replicated by
+// the policy on the source and destination registries, if "apply" is true, jobs are
+// also created to make the destination consistent with the source
+func (pa *RepPolicyAPI) Reconcile() {
+	id := pa.GetIDFromURL()
+	policy, err := dao.GetRepPolicy(id)
+	if err != nil {
+		log.Errorf("failed to get policy %d: %v", id, err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if policy == nil || policy.Deleted == 1 {
+		pa.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	apply, err := pa.GetBool("apply", false)
+	if err != nil {
+		pa.CustomAbort(http.StatusBadRequest, "invalid apply")
+	}
+
+	data, err := json.Marshal(&struct {
+		PolicyID int64 `json:"policy_id"`
+		Apply    bool  `json:"apply"`
+	}{
+		PolicyID: id,
+		Apply:    apply,
+	})
+	if err != nil {
+		log.Errorf("failed to marshal request: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	req, err := http.NewRequest("POST", buildReplicationReconcileURL(), bytes.NewBuffer(data))
+	if err != nil {
+		log.Errorf("failed to create a request: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	addAuthentication(req)
+	client := &http.Client{
+		Timeout: reconcileTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("failed to reconcile policy %d: %v", id, err)
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			pa.CustomAbort(http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout))
+		}
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("failed to read reponse body: %v", err)
+		pa.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		pa.CustomAbort(resp.StatusCode, string(b))
+	}
+
+	pa.Ctx.ResponseWriter.Header().Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	if _, err = pa.Ctx.ResponseWriter.Write(b); err != nil {
+		log.Errorf("failed to write response: %v", err)
+	}
 }
 
 // Delete : policies which are disabled and have no running jobs
@@ -391,4 +483,27 @@ func (pa *RepPolicyAPI) Delete() {
 		log.Errorf("failed to delete policy %d: %v", id, err)
 		pa.CustomAbort(http.StatusInternalServerError, "")
 	}
+
+	go reschedule(id)
+}
+
+// reschedule notifies job service that the schedule of the policy may have changed
+func reschedule(policyID int64) {
+	if err := postReplicationAction(policyID, "reschedule"); err != nil {
+		log.Errorf("failed to reschedule replication of %d: %v", policyID, err)
+	} else {
+		log.Infof("replication of %d rescheduled", policyID)
+	}
+}
+
+// setNextRunTime sets the next run time of the enabled policies which have cron string,
+// it is recorded by the scheduler of job service
+func setNextRunTime(policies ...*models.RepPolicy) {
+	for _, policy := range policies {
+		if policy.Enabled == 0 || len(policy.CronStr) == 0 || policy.NextRun.IsZero() {
+			continue
+		}
+		next := policy.NextRun
+		policy.NextRunTime = &next
+	}
 }
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"sort"
 
+	"github.com/docker/distribution"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/vmware/harbor/src/common/api"
@@ -175,7 +176,7 @@ func (ra *RepositoryAPI) Delete() {
 			ra.CustomAbort(http.StatusInternalServerError, "internal error")
 		}
 		log.Infof("delete tag: %s:%s", repoName, t)
-		go TriggerReplicationByRepository(repoName, []string{t}, models.RepOpDelete)
+		go TriggerReplicationByRepository(repoName, []string{t}, "", models.RepOpDelete)
 
 		go func(tag string) {
 			if err := dao.AccessLog(user, projectName, repoName, tag, "delete"); err != nil {
@@ -309,8 +310,9 @@ func (ra *RepositoryAPI) GetManifests() {
 	}
 
 	result := struct {
-		Manifest interface{} `json:"manifest"`
-		Config   interface{} `json:"config,omitempty" `
+		Manifest  interface{}         `json:"manifest"`
+		Config    interface{}         `json:"config,omitempty" `
+		Platforms []*platformManifest `json:"platforms,omitempty"`
 	}{}
 
 	mediaTypes := []string{}
@@ -318,7 +320,7 @@ func (ra *RepositoryAPI) GetManifests() {
 	case "v1":
 		mediaTypes = append(mediaTypes, schema1.MediaTypeManifest)
 	case "v2":
-		mediaTypes = append(mediaTypes, schema2.MediaTypeManifest)
+		mediaTypes = append(mediaTypes, schema2.MediaTypeManifest, registry.MediaTypeManifestList)
 	}
 
 	_, mediaType, payload, err := rc.PullManifest(tag, mediaTypes)
@@ -339,21 +341,25 @@ func (ra *RepositoryAPI) GetManifests() {
 
 	result.Manifest = manifest
 
-	deserializedmanifest, ok := manifest.(*schema2.DeserializedManifest)
-	if ok {
-		_, data, err := rc.PullBlob(deserializedmanifest.Target().Digest.String())
-		if err != nil {
-			log.Errorf("failed to get config of manifest %s:%s: %v", repoName, tag, err)
-			ra.CustomAbort(http.StatusInternalServerError, "")
-		}
+	config, err := getConfig(rc, manifest)
+	if err != nil {
+		log.Errorf("failed to get config of manifest %s:%s: %v", repoName, tag, err)
+		ra.CustomAbort(http.StatusInternalServerError, "")
+	}
+	if len(config) != 0 {
+		result.Config = config
+	}
 
-		b, err := ioutil.ReadAll(data)
-		if err != nil {
-			log.Errorf("failed to read config of manifest %s:%s: %v", repoName, tag, err)
-			ra.CustomAbort(http.StatusInternalServerError, "")
+	// show the manifest and config for each platform if it is a manifest list
+	if list, ok := manifest.(*registry.ManifestList); ok {
+		for _, descriptor := range list.Manifests {
+			platform, err := getPlatformManifest(rc, descriptor)
+			if err != nil {
+				log.Errorf("failed to get manifest %s referenced by %s:%s: %v", descriptor.Digest, repoName, tag, err)
+				ra.CustomAbort(http.StatusInternalServerError, "")
+			}
+			result.Platforms = append(result.Platforms, platform)
 		}
-
-		result.Config = string(b)
 	}
 
 	ra.Data["json"] = result
@@ -442,3 +448,61 @@ func newRepositoryClient(endpoint string, insecure bool, username, password, rep
 	}
 	return client, nil
 }
+
+// platformManifest is the manifest for a platform referenced by a manifest list
+type platformManifest struct {
+	Digest   string            `json:"digest"`
+	Platform registry.Platform `json:"platform"`
+	Manifest interface{}       `json:"manifest"`
+	Config   interface{}       `json:"config,omitempty"`
+}
+
+func getPlatformManifest(rc *registry.Repository, descriptor registry.ManifestDescriptor) (*platformManifest, error) {
+	_, mediaType, payload, err := rc.PullManifest(descriptor.Digest.String(),
+		[]string{schema2.MediaTypeManifest, schema1.MediaTypeManifest})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, _, err := registry.UnMarshal(mediaType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	platform := &platformManifest{
+		Digest:   descriptor.Digest.String(),
+		Platform: descriptor.Platform,
+		Manifest: manifest,
+	}
+
+	config, err := getConfig(rc, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(config) != 0 {
+		platform.Config = config
+	}
+
+	return platform, nil
+}
+
+// getConfig returns the config of the manifest if the schema of it is v2
+func getConfig(rc *registry.Repository, manifest distribution.Manifest) (string, error) {
+	deserializedmanifest, ok := manifest.(*schema2.DeserializedManifest)
+	if !ok {
+		return "", nil
+	}
+
+	_, data, err := rc.PullBlob(deserializedmanifest.Target().Digest.String())
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
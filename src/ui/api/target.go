@@ -58,6 +58,7 @@ func (t *TargetAPI) Prepare() {
 // Ping validates whether the target is reachable and whether the credential is valid
 func (t *TargetAPI) Ping() {
 	var endpoint, username, password string
+	transportConfig := &registry.TransportConfig{}
 
 	idStr := t.GetString("id")
 	if len(idStr) != 0 {
@@ -87,6 +88,18 @@ func (t *TargetAPI) Ping() {
 				t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 			}
 		}
+
+		t.decryptSecrets(target)
+		transportConfig.Insecure = target.Insecure
+		transportConfig.CACert = target.CACert
+		transportConfig.ClientCert = target.ClientCert
+		transportConfig.ClientKey = target.ClientKey
+		transportConfig.ProxyURL = target.ProxyURL
+		transportConfig.ProxyUsername = target.ProxyUsername
+		transportConfig.ProxyPassword = target.ProxyPassword
+		transportConfig.NoProxy = target.NoProxy
+		transportConfig.TargetID = target.ID
+		transportConfig.UpdateTime = target.UpdateTime
 	} else {
 		endpoint = t.GetString("endpoint")
 		if len(endpoint) == 0 {
@@ -95,9 +108,29 @@ func (t *TargetAPI) Ping() {
 
 		username = t.GetString("username")
 		password = t.GetString("password")
+
+		insecure, err := t.GetBool("insecure", false)
+		if err != nil {
+			t.CustomAbort(http.StatusBadRequest, fmt.Sprintf("insecure %s is invalid", t.GetString("insecure")))
+		}
+		transportConfig.Insecure = insecure
+		transportConfig.CACert = t.GetString("ca_cert")
+		transportConfig.ClientCert = t.GetString("client_cert")
+		transportConfig.ClientKey = t.GetString("client_key")
+		transportConfig.ProxyURL = t.GetString("proxy_url")
+		transportConfig.ProxyUsername = t.GetString("proxy_username")
+		transportConfig.ProxyPassword = t.GetString("proxy_password")
+		transportConfig.NoProxy = t.GetString("no_proxy")
+		if err = transportConfig.Validate(); err != nil {
+			t.CustomAbort(http.StatusBadRequest, err.Error())
+		}
 	}
 
-	registry, err := newRegistryClient(endpoint, api.GetIsInsecure(), username, password,
+	// the certificate of the target is not verified if either the target or
+	// the global setting says so
+	transportConfig.Insecure = transportConfig.Insecure || api.GetIsInsecure()
+
+	registry, err := newRegistryClient(endpoint, transportConfig, username, password,
 		"", "", "")
 	if err != nil {
 		// timeout, dns resolve error, connection refused, etc.
@@ -148,6 +181,16 @@ func (t *TargetAPI) Get() {
 		}
 		target.Password = pwd
 	}
+	maskSecrets(target)
+
+	statuses, err := dao.GetLatestRepTargetStatuses(id)
+	if err != nil {
+		log.Errorf("failed to get status of target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	if len(statuses) > 0 {
+		target.Status = statuses[0]
+	}
 
 	t.Data["json"] = target
 	t.ServeJSON()
@@ -162,7 +205,20 @@ func (t *TargetAPI) List() {
 		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 	}
 
+	statuses, err := dao.GetLatestRepTargetStatuses()
+	if err != nil {
+		log.Errorf("failed to get status of targets: %v", err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	statusMap := map[int64]*models.RepTargetStatus{}
+	for _, status := range statuses {
+		statusMap[status.TargetID] = status
+	}
+
 	for _, target := range targets {
+		target.Status = statusMap[target.ID]
+		maskSecrets(target)
+
 		if len(target.Password) == 0 {
 			continue
 		}
@@ -213,6 +269,8 @@ func (t *TargetAPI) Post() {
 		}
 	}
 
+	t.encryptSecrets(target)
+
 	id, err := dao.AddRepTarget(*target)
 	if err != nil {
 		log.Errorf("failed to add target: %v", err)
@@ -255,7 +313,17 @@ func (t *TargetAPI) Put() {
 	}
 
 	target := &models.RepTarget{}
-	t.DecodeJSONReqAndValidate(target)
+	t.DecodeJSONReq(target)
+	// the client key and the proxy password are write-only, the stored ones are
+	// kept if they are not provided while the certificate and the username are
+	t.decryptSecrets(originalTarget)
+	if len(target.ClientKey) == 0 && len(target.ClientCert) != 0 {
+		target.ClientKey = originalTarget.ClientKey
+	}
+	if len(target.ProxyPassword) == 0 && len(target.ProxyUsername) != 0 {
+		target.ProxyPassword = originalTarget.ProxyPassword
+	}
+	t.Validate(target)
 
 	if target.Name != originalTarget.Name {
 		ta, err := dao.GetRepTargetByName(target.Name)
@@ -291,6 +359,8 @@ func (t *TargetAPI) Put() {
 		}
 	}
 
+	t.encryptSecrets(target)
+
 	if err := dao.UpdateRepTarget(*target); err != nil {
 		log.Errorf("failed to update target %d: %v", id, err)
 		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
@@ -327,17 +397,61 @@ func (t *TargetAPI) Delete() {
 	}
 }
 
-func newRegistryClient(endpoint string, insecure bool, username, password, scopeType, scopeName string,
+// encryptSecrets encrypts the client key and the proxy password of the target as the password
+func (t *TargetAPI) encryptSecrets(target *models.RepTarget) {
+	for _, secret := range []*string{&target.ClientKey, &target.ProxyPassword} {
+		if len(*secret) == 0 {
+			continue
+		}
+
+		str, err := utils.ReversibleEncrypt(*secret, t.secretKey)
+		if err != nil {
+			log.Errorf("failed to encrypt secret of target: %v", err)
+			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		*secret = str
+	}
+}
+
+// maskSecrets removes the client key and the proxy password from the target returned
+// to the client, they are write-only
+func maskSecrets(target *models.RepTarget) {
+	target.ClientKey = ""
+	target.ProxyPassword = ""
+}
+
+// decryptSecrets decrypts the client key and the proxy password of the target read from DB
+func (t *TargetAPI) decryptSecrets(target *models.RepTarget) {
+	for _, secret := range []*string{&target.ClientKey, &target.ProxyPassword} {
+		if len(*secret) == 0 {
+			continue
+		}
+
+		str, err := utils.ReversibleDecrypt(*secret, t.secretKey)
+		if err != nil {
+			log.Errorf("failed to decrypt secret of target: %v", err)
+			t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		*secret = str
+	}
+}
+
+func newRegistryClient(endpoint string, transportConfig *registry.TransportConfig, username, password, scopeType, scopeName string,
 	scopeActions ...string) (*registry.Registry, error) {
+	transport, err := registry.GetTransport(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	credential := auth.NewBasicAuthCredential(username, password)
-	authorizer := auth.NewStandardTokenAuthorizer(credential, insecure, scopeType, scopeName, scopeActions...)
+	authorizer := auth.NewStandardTokenAuthorizerWithTransport(credential, transport, scopeType, scopeName, scopeActions...)
 
-	store, err := auth.NewAuthorizerStore(endpoint, insecure, authorizer)
+	store, err := auth.NewAuthorizerStoreWithTransport(endpoint, transport, authorizer)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := registry.NewRegistryWithModifiers(endpoint, insecure, store)
+	client, err := registry.NewRegistryWithTransport(endpoint, transport, store)
 	if err != nil {
 		return nil, err
 	}
@@ -367,3 +481,31 @@ func (t *TargetAPI) ListPolicies() {
 	t.Data["json"] = policies
 	t.ServeJSON()
 }
+
+// ListStatuses lists the results of the health checks of the target, the latest first
+func (t *TargetAPI) ListStatuses() {
+	id := t.GetIDFromURL()
+
+	target, err := dao.GetRepTarget(id)
+	if err != nil {
+		log.Errorf("failed to get target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if target == nil {
+		t.CustomAbort(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+
+	page, pageSize := t.GetPaginationParams()
+
+	statuses, total, err := dao.FilterRepTargetStatuses(id, pageSize, pageSize*(page-1))
+	if err != nil {
+		log.Errorf("failed to filter statuses of target %d: %v", id, err)
+		t.CustomAbort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	t.SetPaginationHeader(total, page, pageSize)
+
+	t.Data["json"] = statuses
+	t.ServeJSON()
+}
@@ -23,6 +23,7 @@ import (
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -100,19 +101,26 @@ func checkUserExists(name string) int {
 	return 0
 }
 
-// TriggerReplication triggers the replication according to the policy
+// TriggerReplication triggers the replication according to the policy, the only
+// tag is replicated at the digest if it is not empty, the digest is ignored unless
+// there is exactly one tag. Trigger is recorded on the execution of the policy
+// created by the replication
 func TriggerReplication(policyID int64, repository string,
-	tags []string, operation string) error {
+	tags []string, digest, operation, trigger string) error {
 	data := struct {
 		PolicyID  int64    `json:"policy_id"`
 		Repo      string   `json:"repository"`
 		Operation string   `json:"operation"`
 		TagList   []string `json:"tags"`
+		Digest    string   `json:"digest,omitempty"`
+		Trigger   string   `json:"trigger"`
 	}{
 		PolicyID:  policyID,
 		Repo:      repository,
 		TagList:   tags,
+		Digest:    digest,
 		Operation: operation,
+		Trigger:   trigger,
 	}
 
 	b, err := json.Marshal(&data)
@@ -166,8 +174,10 @@ func GetPoliciesByRepository(repository string) ([]*models.RepPolicy, error) {
 	return policies, nil
 }
 
-// TriggerReplicationByRepository triggers the replication according to the repository
-func TriggerReplicationByRepository(repository string, tags []string, operation string) {
+// TriggerReplicationByRepository triggers the replication according to the repository,
+// the only tag is replicated at the digest if it is not empty, the digest is ignored
+// unless there is exactly one tag
+func TriggerReplicationByRepository(repository string, tags []string, digest, operation string) {
 	policies, err := GetPoliciesByRepository(repository)
 	if err != nil {
 		log.Errorf("failed to get policies for repository %s: %v", repository, err)
@@ -175,10 +185,23 @@ func TriggerReplicationByRepository(repository string, tags []string, operation
 	}
 
 	for _, policy := range policies {
-		if policy.Enabled == 0 {
+		// pull policies replicate from the target, the changes of local
+		// repositories do not trigger them
+		if policy.Enabled == 0 || policy.Direction == models.RepDirectionPull {
 			continue
 		}
-		if err := TriggerReplication(policy.ID, repository, tags, operation); err != nil {
+		if !policy.MatchRepository(repository) {
+			log.Debugf("repository %s is not selected by the filters of policy %d, skip", repository, policy.ID)
+			continue
+		}
+		selected := tags
+		if len(tags) > 0 {
+			if selected = policy.FilterTags(tags); len(selected) == 0 {
+				log.Debugf("tags %v of %s are not selected by the filters of policy %d, skip", tags, repository, policy.ID)
+				continue
+			}
+		}
+		if err := TriggerReplication(policy.ID, repository, selected, digest, operation, models.RepTriggerPush); err != nil {
 			log.Errorf("failed to trigger replication of policy %d for %s: %v", policy.ID, repository, err)
 		} else {
 			log.Infof("replication of policy %d for %s triggered", policy.ID, repository)
@@ -230,6 +253,71 @@ func postReplicationAction(policyID int64, acton string) error {
 	return fmt.Errorf("%d %s", resp.StatusCode, string(b))
 }
 
+// postJobAction posts the action to the job on job service, and returns
+// the status code and message of the response
+func postJobAction(jobID int64, action string) (int, string, error) {
+	data := struct {
+		Action string `json:"action"`
+	}{
+		Action: action,
+	}
+
+	b, err := json.Marshal(&data)
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequest("POST", buildJobActionURL(strconv.FormatInt(jobID, 10)), bytes.NewBuffer(b))
+	if err != nil {
+		return 0, "", err
+	}
+
+	addAuthentication(req)
+
+	client := &http.Client{}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return resp.StatusCode, string(b), nil
+}
+
+// postExecutionRetry calls job service to put the failed jobs of the execution back
+// to the job queue, it returns the status code and the body of the response
+func postExecutionRetry(executionID int64) (int, string, error) {
+	req, err := http.NewRequest("POST", buildExecutionRetryURL(executionID), nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	addAuthentication(req)
+
+	client := &http.Client{}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return resp.StatusCode, string(b), nil
+}
+
 func addAuthentication(req *http.Request) {
 	if req != nil {
 		req.AddCookie(&http.Cookie{
@@ -468,6 +556,26 @@ func buildJobLogURL(jobID string) string {
 	return fmt.Sprintf("%s/api/jobs/replication/%s/log", url, jobID)
 }
 
+func buildJobActionURL(jobID string) string {
+	url := config.InternalJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/%s/actions", url, jobID)
+}
+
+func buildJobPurgeURL() string {
+	url := config.InternalJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/purge", url)
+}
+
+func buildReplicationReconcileURL() string {
+	url := config.InternalJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/reconcile", url)
+}
+
+func buildExecutionRetryURL(executionID int64) string {
+	url := config.InternalJobServiceURL()
+	return fmt.Sprintf("%s/api/jobs/replication/executions/%d/retry", url, executionID)
+}
+
 func buildReplicationActionURL() string {
 	url := config.InternalJobServiceURL()
 	return fmt.Sprintf("%s/api/jobs/replication/actions", url)
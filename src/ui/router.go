@@ -70,16 +70,22 @@ func initRouters() {
 	beego.Router("/api/repositories/tags", &api.RepositoryAPI{}, "get:GetTags")
 	beego.Router("/api/repositories/manifests", &api.RepositoryAPI{}, "get:GetManifests")
 	beego.Router("/api/jobs/replication/", &api.RepJobAPI{}, "get:List")
+	beego.Router("/api/jobs/replication/purge", &api.RepJobAPI{}, "post:Purge")
+	beego.Router("/api/jobs/replication/executions", &api.RepExecutionAPI{}, "get:List")
+	beego.Router("/api/jobs/replication/executions/:id([0-9]+)", &api.RepExecutionAPI{})
+	beego.Router("/api/jobs/replication/executions/:id([0-9]+)/retry", &api.RepExecutionAPI{}, "post:Retry")
 	beego.Router("/api/jobs/replication/:id([0-9]+)", &api.RepJobAPI{})
 	beego.Router("/api/jobs/replication/:id([0-9]+)/log", &api.RepJobAPI{}, "get:GetLog")
 	beego.Router("/api/policies/replication/:id([0-9]+)", &api.RepPolicyAPI{})
 	beego.Router("/api/policies/replication", &api.RepPolicyAPI{}, "get:List")
 	beego.Router("/api/policies/replication", &api.RepPolicyAPI{}, "post:Post")
 	beego.Router("/api/policies/replication/:id([0-9]+)/enablement", &api.RepPolicyAPI{}, "put:UpdateEnablement")
+	beego.Router("/api/policies/replication/:id([0-9]+)/reconcile", &api.RepPolicyAPI{}, "post:Reconcile")
 	beego.Router("/api/targets/", &api.TargetAPI{}, "get:List")
 	beego.Router("/api/targets/", &api.TargetAPI{}, "post:Post")
 	beego.Router("/api/targets/:id([0-9]+)", &api.TargetAPI{})
 	beego.Router("/api/targets/:id([0-9]+)/policies/", &api.TargetAPI{}, "get:ListPolicies")
+	beego.Router("/api/targets/:id([0-9]+)/statuses/", &api.TargetAPI{}, "get:ListStatuses")
 	beego.Router("/api/targets/ping", &api.TargetAPI{}, "post:Ping")
 	beego.Router("/api/users/:id/sysadmin", &api.UserAPI{}, "put:ToggleUserAdminRole")
 	beego.Router("/api/repositories/top", &api.RepositoryAPI{}, "get:GetTopRepos")
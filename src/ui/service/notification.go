@@ -86,7 +86,9 @@ func (n *NotificationHandler) Post() {
 					log.Errorf("failed to refresh cache: %v", err)
 				}
 			}()
-			go api.TriggerReplicationByRepository(repository, []string{tag}, models.RepOpTransfer)
+			// the digest of the event pins the tag, so the image pushed is replicated even
+			// if the tag is pushed again before the job runs
+			go api.TriggerReplicationByRepository(repository, []string{tag}, event.Target.Digest, models.RepOpTransfer)
 		}
 		if action == "pull" {
 			go func() {
@@ -95,8 +95,13 @@ class ReplicationPolicy(Base):
     target_id = sa.Column(sa.Integer, nullable=False)
     enabled = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'1'"))
     description = sa.Column(sa.Text)
+    deleted = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'"))
+    direction = sa.Column(sa.String(8), nullable=False, server_default=sa.text("'push'"))
+    filters = sa.Column(sa.Text)
+    time_windows = sa.Column(sa.Text)
     cron_str = sa.Column(sa.String(256))
     start_time = sa.Column(mysql.TIMESTAMP)
+    next_run_time = sa.Column(mysql.TIMESTAMP, nullable=True)
     creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
     update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
 
@@ -109,6 +114,15 @@ class ReplicationTarget(Base):
     username = sa.Column(sa.String(40))
     password = sa.Column(sa.String(40))
     target_type = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'"))
+    bandwidth_limit = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    insecure = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'"))
+    ca_cert = sa.Column(sa.Text)
+    client_cert = sa.Column(sa.Text)
+    client_key = sa.Column(sa.Text)
+    proxy_url = sa.Column(sa.String(256))
+    proxy_username = sa.Column(sa.String(40))
+    proxy_password = sa.Column(sa.String(128))
+    no_proxy = sa.Column(sa.String(512))
     creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
     update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
 
@@ -117,15 +131,76 @@ class ReplicationJob(Base):
 
     id = sa.Column(sa.Integer, primary_key=True)
     status = sa.Column(sa.String(64), nullable=False)
+    kind = sa.Column(sa.String(64), nullable=False, server_default=sa.text("'replication'"))
     policy_id = sa.Column(sa.Integer, nullable=False)
     repository = sa.Column(sa.String(256), nullable=False)
     operation = sa.Column(sa.String(64), nullable=False)
     tags = sa.Column(sa.String(16384))
+    digest = sa.Column(sa.String(128))
+    execution_id = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    retry_count = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    next_attempt_time = sa.Column(mysql.TIMESTAMP, nullable=True)
+    progress = sa.Column(sa.Text)
+    lease_owner = sa.Column(sa.String(64))
+    lease_expire_time = sa.Column(mysql.TIMESTAMP, nullable=True)
     creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
     update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
     
+    __table_args__ = (sa.Index('policy', "policy_id"), sa.Index('poid_uptime', "policy_id", "update_time"),
+        sa.Index('status', "status"), sa.Index('execution', "execution_id"))
+
+class ReplicationExecution(Base):
+    __tablename__ = "replication_execution"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    policy_id = sa.Column(sa.Integer, nullable=False)
+    trigger_source = sa.Column(sa.String(64), nullable=False)
+    start_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+
     __table_args__ = (sa.Index('policy', "policy_id"),)
 
+class ReplicationJobAttempt(Base):
+    __tablename__ = "replication_job_attempt"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    job_id = sa.Column(sa.Integer, nullable=False)
+    attempt = sa.Column(sa.Integer, nullable=False)
+    error = sa.Column(sa.Text)
+    creation_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+
+    __table_args__ = (sa.Index('job', "job_id"),)
+
+class ReplicationBlobLocation(Base):
+    __tablename__ = "replication_blob_location"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    target_id = sa.Column(sa.Integer, nullable=False)
+    digest = sa.Column(sa.String(128), nullable=False)
+    repository = sa.Column(sa.String(256), nullable=False)
+    update_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"))
+
+    __table_args__ = (sa.UniqueConstraint('target_id', 'digest'),)
+
+class ReplicationTargetStatus(Base):
+    __tablename__ = "replication_target_status"
+
+    id = sa.Column(sa.Integer, primary_key=True)
+    target_id = sa.Column(sa.Integer, nullable=False)
+    reachable = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'"))
+    auth_valid = sa.Column(mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'"))
+    latency = sa.Column(sa.Integer, nullable=False, server_default=sa.text("'0'"))
+    error = sa.Column(sa.Text)
+    check_time = sa.Column(mysql.TIMESTAMP, server_default = sa.text("CURRENT_TIMESTAMP"))
+
+    __table_args__ = (sa.Index('target', "target_id"),)
+
+class Lease(Base):
+    __tablename__ = "lease"
+
+    name = sa.Column(sa.String(64), primary_key=True)
+    owner = sa.Column(sa.String(64), nullable=False)
+    expire_time = sa.Column(mysql.TIMESTAMP, nullable=True)
+
 class Repository(Base):
     __tablename__ = "repository"
 
@@ -0,0 +1,79 @@
+# Copyright (c) 2008-2016 VMware, Inc. All Rights Reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""0.4.0 to 0.5.0
+
+Revision ID: 0.5.0
+Revises: 0.4.0
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '0.5.0'
+down_revision = '0.4.0'
+branch_labels = None
+depends_on = None
+
+from alembic import op
+from db_meta import *
+
+from sqlalchemy.dialects import mysql
+
+def upgrade():
+    """
+    update schema&data
+    """
+    bind = op.get_bind()
+    #add columns to table replication_policy for the direction, filters, time windows and schedule of policies
+    op.add_column('replication_policy', sa.Column('direction', sa.String(8), nullable=False, server_default=sa.text("'push'")))
+    op.add_column('replication_policy', sa.Column('filters', sa.Text))
+    op.add_column('replication_policy', sa.Column('time_windows', sa.Text))
+    op.add_column('replication_policy', sa.Column('next_run_time', mysql.TIMESTAMP, nullable=True))
+    #add columns to table replication_target for the bandwidth limit, TLS and proxy settings of targets
+    op.add_column('replication_target', sa.Column('bandwidth_limit', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_target', sa.Column('insecure', mysql.TINYINT(1), nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_target', sa.Column('ca_cert', sa.Text))
+    op.add_column('replication_target', sa.Column('client_cert', sa.Text))
+    op.add_column('replication_target', sa.Column('client_key', sa.Text))
+    op.add_column('replication_target', sa.Column('proxy_url', sa.String(256)))
+    op.add_column('replication_target', sa.Column('proxy_username', sa.String(40)))
+    op.add_column('replication_target', sa.Column('proxy_password', sa.String(128)))
+    op.add_column('replication_target', sa.Column('no_proxy', sa.String(512)))
+    #add columns to table replication_job for the job queue, retries, progress and executions of jobs
+    op.add_column('replication_job', sa.Column('kind', sa.String(64), nullable=False, server_default=sa.text("'replication'")))
+    op.add_column('replication_job', sa.Column('digest', sa.String(128)))
+    op.add_column('replication_job', sa.Column('execution_id', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('retry_count', sa.Integer, nullable=False, server_default=sa.text("'0'")))
+    op.add_column('replication_job', sa.Column('next_attempt_time', mysql.TIMESTAMP, nullable=True))
+    op.add_column('replication_job', sa.Column('progress', sa.Text))
+    op.add_column('replication_job', sa.Column('lease_owner', sa.String(64)))
+    op.add_column('replication_job', sa.Column('lease_expire_time', mysql.TIMESTAMP, nullable=True))
+    #create index status (status), execution (execution_id) on table replication_job
+    op.create_index('status', 'replication_job', ['status'])
+    op.create_index('execution', 'replication_job', ['execution_id'])
+    #the running jobs left by the job service before the upgrade have no lease, they are
+    #put back to the job queue so they are claimed again once the job service starts
+    op.execute("update replication_job set status = 'pending' where status = 'running'")
+    #create tables: replication_execution, replication_job_attempt, replication_blob_location, replication_target_status, lease
+    ReplicationExecution.__table__.create(bind)
+    ReplicationJobAttempt.__table__.create(bind)
+    ReplicationBlobLocation.__table__.create(bind)
+    ReplicationTargetStatus.__table__.create(bind)
+    Lease.__table__.create(bind)
+
+def downgrade():
+    """
+    Downgrade has been disabled.
+    """
+    pass